@@ -0,0 +1,250 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// Scanner workstations bundle their nightly exports into archives. An input
+// that is a .zip, .gz, .tar or .tar.gz file is read member by member: each
+// member goes through the same decoding, header detection and row parsing as a
+// single input, and members that fail are reported by name without stopping
+// the others
+
+// gzipMagic starts every gzip stream
+const gzipMagic = "\x1f\x8b"
+
+// tarMagicOffset is where a POSIX tar header holds "ustar"
+const tarMagicOffset = 257
+
+// archiveMember is one file of an archive input, parsed into memory
+type archiveMember struct {
+    Name     string       // Path of the member within the archive
+    Encoding string       // Encoding of the member, as shown by --dry-run
+    Sections []Section    // Sections read from the member
+    Diags    []Diagnostic // Rows skipped or repaired, tagged with the member name
+    Err      error        // Why the member couldn't be converted, if it couldn't
+}
+
+// inputSource prepares an opened input for reading. A regular file is also
+// returned as an io.ReaderAt, so an archive in it can be read in place.
+// Standard input and other streams can't be read at random: when one starts
+// like an archive it is read into memory, otherwise ra is nil and it streams
+func inputSource(f *os.File) (src io.Reader, ra io.ReaderAt, size int64, err error) {
+    if isRegularFile(f) {
+        info, err := f.Stat()
+        if err != nil {
+            return nil, nil, 0, err
+        }
+        return f, f, info.Size(), nil
+    }
+
+    br := bufio.NewReaderSize(f, tarMagicOffset+5)
+    head, _ := br.Peek(tarMagicOffset + 5)
+    if !strings.HasPrefix(string(head), zipMagic) && !strings.HasPrefix(string(head), gzipMagic) && !isTarHeader(head) {
+        return br, nil, 0, nil
+    }
+    data, err := io.ReadAll(br)
+    if err != nil {
+        return nil, nil, 0, err
+    }
+    return bytes.NewReader(data), bytes.NewReader(data), int64(len(data)), nil
+}
+
+// archiveKind identifies an archive input from its first bytes: "zip", "gzip",
+// "tar" or "" for anything else. XLSX workbooks are zip files too but are read
+// as a single input, so they give ""
+func archiveKind(r io.ReaderAt, size int64) string {
+    head := make([]byte, tarMagicOffset+5)
+    n, _ := r.ReadAt(head, 0)
+    head = head[:n]
+    switch {
+    case strings.HasPrefix(string(head), zipMagic):
+        zr, err := zip.NewReader(r, size)
+        if err != nil {
+            return "zip" // Reported when the members are read
+        }
+        for _, f := range zr.File {
+            if strings.TrimPrefix(f.Name, "/") == "xl/workbook.xml" {
+                return ""
+            }
+        }
+        return "zip"
+    case strings.HasPrefix(string(head), gzipMagic):
+        return "gzip"
+    case isTarHeader(head):
+        return "tar"
+    }
+    return ""
+}
+
+// isTarHeader reports whether a block starts with a POSIX (ustar) tar header
+func isTarHeader(head []byte) bool {
+    return len(head) >= tarMagicOffset+5 && string(head[tarMagicOffset:tarMagicOffset+5]) == "ustar"
+}
+
+// readArchive parses every member of an archive input of the given kind (see
+// archiveKind). name is the archive's file name, which names the member of a
+// plain .gz file. Members are read in archive order; directories, hidden files
+// and macOS resource forks (__MACOSX/) are left out
+// An error is returned only when the archive itself can't be read; a member
+// that fails to parse has its Err set
+func readArchive(r io.ReaderAt, size int64, kind, name string, encoding, sheet string, opts ParseOptions) ([]archiveMember, error) {
+    members := []archiveMember{}
+    add := func(member string, mr io.Reader) {
+        members = append(members, parseMember(member, mr, encoding, sheet, opts))
+    }
+
+    switch kind {
+    case "zip":
+        zr, err := zip.NewReader(r, size)
+        if err != nil {
+            return nil, fmt.Errorf("reading zip archive: %w", err)
+        }
+        for _, f := range zr.File {
+            if f.FileInfo().IsDir() || skipMember(f.Name) {
+                continue
+            }
+            rc, err := f.Open()
+            if err != nil {
+                members = append(members, archiveMember{Name: f.Name, Err: err})
+                continue
+            }
+            add(f.Name, rc)
+            rc.Close()
+        }
+
+    case "gzip", "tar":
+        var stream io.Reader = io.NewSectionReader(r, 0, size)
+        member := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+        if kind == "gzip" {
+            gz, err := gzip.NewReader(stream)
+            if err != nil {
+                return nil, fmt.Errorf("reading gzip file: %w", err)
+            }
+            defer gz.Close()
+            if gz.Name != "" {
+                member = gz.Name
+            }
+            stream = gz
+        }
+
+        // A gzip file holds a single member unless it is a compressed tar
+        br := bufio.NewReader(stream)
+        if head, _ := br.Peek(tarMagicOffset + 5); !isTarHeader(head) {
+            add(member, br)
+            break
+        }
+        tr := tar.NewReader(br)
+        for {
+            h, err := tr.Next()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                return members, fmt.Errorf("reading tar archive: %w", err)
+            }
+            if h.Typeflag != tar.TypeReg || skipMember(h.Name) {
+                continue
+            }
+            add(h.Name, tr)
+        }
+
+    default:
+        return nil, fmt.Errorf("unknown archive kind %q", kind)
+    }
+    return members, nil
+}
+
+// skipMember reports whether an archive member is a hidden file (.DS_Store,
+// ._name) or a macOS resource fork rather than an export
+func skipMember(name string) bool {
+    return strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/")
+}
+
+// parseMember reads one archive member into memory, like a single input:
+// decoded or read as an XLSX workbook, then parsed section by section
+func parseMember(name string, r io.Reader, encoding, sheet string, opts ParseOptions) archiveMember {
+    m := archiveMember{Name: name}
+    text, encodingName, err := readInput(r, encoding, sheet)
+    if err != nil {
+        m.Err = err
+        return m
+    }
+    m.Encoding = encodingName
+
+    rr, err := NewRecordReader(text, opts)
+    if err != nil {
+        m.Err = err
+        return m
+    }
+    m.Sections, m.Err = readSections(rr)
+    for _, d := range rr.Diagnostics() {
+        d.File = name
+        m.Diags = append(m.Diags, d)
+    }
+    return m
+}
+
+// mergeSections combines the sections of several members into one section per
+// type, in first-seen order, so records of the same type share one CSV table
+// Members that failed are left out
+func mergeSections(members []archiveMember) []Section {
+    all := []Section{}
+    types := []DXAType{}
+    seen := map[DXAType]bool{}
+    for _, m := range members {
+        if m.Err != nil {
+            continue
+        }
+        for _, s := range m.Sections {
+            all = append(all, s)
+            if !seen[s.Type] {
+                seen[s.Type] = true
+                types = append(types, s.Type)
+            }
+        }
+    }
+
+    merged := []Section{}
+    for _, t := range types {
+        merged = append(merged, Section{Type: t, Records: concatRecords(t, all)})
+    }
+    return merged
+}
+
+// sectionRecordCount returns the number of records of a section
+func sectionRecordCount(s Section) int {
+    n := 0
+    it := iterateRecords(s.Type, s.Records)
+    for {
+        if _, err := it.Next(); err != nil {
+            return n
+        }
+        n++
+    }
+}
+
+// memberOutputPath names the output file of an archive member for
+// --per-member: the member's file name, without its extension, goes before the
+// output extension, numbered when several members share a name:
+// nightly.zip.json -> nightly.zip.P001.json, nightly.zip.P001-2.json
+func memberOutputPath(output, member string, n int) string {
+    ext := filepath.Ext(output)
+    base := path.Base(member)
+    base = strings.TrimSuffix(base, path.Ext(base))
+    name := strings.TrimSuffix(output, ext) + "." + base
+    if n > 1 {
+        name += fmt.Sprintf("-%d", n)
+    }
+    return name + ext
+}
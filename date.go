@@ -0,0 +1,170 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// ScanDate is a scan date parsed from the export into a timestamp
+// The zero value means the date cell was empty; it is written as null in JSON
+// and as an empty cell in CSV
+type ScanDate struct {
+    time.Time
+    HasClock bool   // Source value included a time of day
+    text     string // Source cell text, written back by the "input" format
+    layout   string // Output layout (see withDateFormat); "" means "input"
+}
+
+// isoDate and isoDateTime are the layouts of the "iso" output format
+const (
+    isoDate     = "2006-01-02"
+    isoDateTime = "2006-01-02T15:04:05"
+)
+
+// isoLayouts are unambiguous and accepted whatever the configured date order
+var isoLayouts = []string{
+    "2006-01-02",
+    "2006-01-02 15:04",
+    "2006-01-02 15:04:05",
+    "2006-01-02T15:04:05",
+    time.RFC3339,
+}
+
+// dateInputLayouts maps the --date-input presets to the layouts they accept
+// Single-digit layout elements also accept zero-padded values ("1/2" matches "01/02")
+var dateInputLayouts = map[string][]string{
+    "us": {
+        "1/2/2006",
+        "1/2/2006 15:04",
+        "1/2/2006 15:04:05",
+        "1/2/2006 3:04 PM",
+        "1/2/2006 3:04:05 PM",
+        "1/2/06",
+        "1-2-2006",
+    },
+    "eu": {
+        "2/1/2006",
+        "2/1/2006 15:04",
+        "2/1/2006 15:04:05",
+        "2.1.2006",
+        "2.1.2006 15:04",
+        "2.1.2006 15:04:05",
+        "2/1/06",
+        "2-1-2006",
+    },
+    "iso": {},
+}
+
+// dateOutputLayouts maps the --date-format presets to Go layouts
+// Each preset has a date-only and a date-and-time variant; "input", the
+// default, writes each date as the export did (see ScanDate.String)
+var dateOutputLayouts = map[string][2]string{
+    "iso": {isoDate, isoDateTime},
+    "us":  {"01/02/2006", "01/02/2006 15:04:05"},
+    "eu":  {"02/01/2006", "02/01/2006 15:04:05"},
+}
+
+// dateInputDescriptions explain each preset in error messages
+var dateInputDescriptions = map[string]string{
+    "us":  "MM/DD/YYYY",
+    "eu":  "DD/MM/YYYY",
+    "iso": "YYYY-MM-DD",
+}
+
+// resolveDateInput returns the layouts to try for a --date-input value
+// name is a preset (us, eu, iso) or a custom Go layout such as "2006/01/02"
+// ISO layouts are always accepted as well
+func resolveDateInput(name string) ([]string, error) {
+    if name == "" {
+        name = "us"
+    }
+    if layouts, ok := dateInputLayouts[strings.ToLower(name)]; ok {
+        return append(append([]string{}, layouts...), isoLayouts...), nil
+    }
+    if !strings.Contains(name, "06") {
+        return nil, fmt.Errorf("invalid date input %q: use us, eu, iso or a Go layout such as 2006/01/02", name)
+    }
+    return append([]string{name}, isoLayouts...), nil
+}
+
+// describeDateInput returns a human-readable form of a --date-input value
+func describeDateInput(name string) string {
+    if name == "" {
+        name = "us"
+    }
+    if d, ok := dateInputDescriptions[strings.ToLower(name)]; ok {
+        return d
+    }
+    return name
+}
+
+// parseScanDate parses a date cell with the first layout that matches
+// An empty cell gives the zero ScanDate
+func parseScanDate(cell string, layouts []string) (ScanDate, error) {
+    cell = strings.TrimSpace(cell)
+    if cell == "" {
+        return ScanDate{}, nil
+    }
+
+    for _, layout := range layouts {
+        if t, err := time.Parse(layout, cell); err == nil {
+            return ScanDate{Time: t, HasClock: strings.Contains(layout, ":"), text: cell}, nil
+        }
+    }
+    return ScanDate{}, fmt.Errorf("unrecognized date %q", cell)
+}
+
+// resolveDateFormat validates a --date-format value and returns it normalized
+// name is a preset (input, iso, us, eu) or a custom Go layout used for every date
+func resolveDateFormat(name string) (string, error) {
+    if name == "" || strings.EqualFold(name, "input") {
+        return "input", nil
+    }
+    if _, ok := dateOutputLayouts[strings.ToLower(name)]; ok {
+        return strings.ToLower(name), nil
+    }
+    if !strings.Contains(name, "06") {
+        return "", fmt.Errorf("invalid date format %q: use input, iso, us, eu or a Go layout such as 02-Jan-2006", name)
+    }
+    return name, nil
+}
+
+// String formats the date with its output layout
+// "input" writes the source cell text, as earlier releases did; presets pick
+// the date-and-time variant only when the source had a time of day
+func (d ScanDate) String() string {
+    if d.IsZero() {
+        return ""
+    }
+
+    layout := d.layout
+    if layout == "" || layout == "input" {
+        if d.text != "" {
+            return d.text
+        }
+        layout = "iso" // Not read from a cell
+    }
+    if preset, ok := dateOutputLayouts[layout]; ok {
+        layout = preset[0]
+        if d.HasClock {
+            layout = preset[1]
+        }
+    }
+    return d.Format(layout)
+}
+
+// MarshalJSON writes the formatted date as a string, or null when empty
+func (d ScanDate) MarshalJSON() ([]byte, error) {
+    if d.IsZero() {
+        return []byte("null"), nil
+    }
+    return json.Marshal(d.String())
+}
+
+// withDateFormat returns a copy of the date that formats with the given layout
+func (d ScanDate) withDateFormat(layout string) ScanDate {
+    d.layout = layout
+    return d
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestScanDateFormat(t *testing.T) {
+    tests := []struct {
+        cell   string
+        input  string // --date-input
+        format string // --date-format, "" for the default
+        want   string
+    }{
+        // The default writes the date as the export did
+        {"11/11/2025", "us", "", "11/11/2025"},
+        {" 3/4/2025 ", "us", "", "3/4/2025"},
+        {"03/04/2025 14:30", "us", "input", "03/04/2025 14:30"},
+        {"2025-03-04", "us", "", "2025-03-04"},
+        {"4.3.2025", "eu", "", "4.3.2025"},
+
+        // Presets and layouts
+        {"3/4/2025", "us", "iso", "2025-03-04"},
+        {"3/4/2025 2:30 PM", "us", "iso", "2025-03-04T14:30:00"},
+        {"3/4/2025", "eu", "iso", "2025-04-03"},
+        {"2025-03-04", "us", "us", "03/04/2025"},
+        {"2025-03-04", "us", "eu", "04/03/2025"},
+        {"3/4/2025", "us", "02 Jan 2006", "04 Mar 2025"},
+        {"", "us", "", ""},
+    }
+
+    for _, tt := range tests {
+        layouts, err := resolveDateInput(tt.input)
+        if err != nil {
+            t.Fatal(err)
+        }
+        format, err := resolveDateFormat(tt.format)
+        if err != nil {
+            t.Fatal(err)
+        }
+        d, err := parseScanDate(tt.cell, layouts)
+        if err != nil {
+            t.Errorf("parseScanDate(%q): %v", tt.cell, err)
+            continue
+        }
+        if got := d.withDateFormat(format).String(); got != tt.want {
+            t.Errorf("date %q with --date-format %q = %q, want %q", tt.cell, tt.format, got, tt.want)
+        }
+    }
+}
+
+func TestScanDateJSON(t *testing.T) {
+    layouts, _ := resolveDateInput("us")
+    d, err := parseScanDate("11/11/2025", layouts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, tt := range []struct {
+        date ScanDate
+        want string
+    }{
+        {d, `"11/11/2025"`},
+        {d.withDateFormat("iso"), `"2025-11-11"`},
+        {ScanDate{}, `null`},
+    } {
+        if got, err := json.Marshal(tt.date); err != nil || string(got) != tt.want {
+            t.Errorf("json.Marshal(%v) = %s, %v, want %s", tt.date, got, err, tt.want)
+        }
+    }
+}
+
+func TestResolveDateFormat(t *testing.T) {
+    tests := []struct {
+        name string
+        want string
+        ok   bool
+    }{
+        {"", "input", true},
+        {"Input", "input", true},
+        {"ISO", "iso", true},
+        {"eu", "eu", true},
+        {"2006/01/02", "2006/01/02", true},
+        {"yyyy-mm-dd", "", false},
+    }
+
+    for _, tt := range tests {
+        got, err := resolveDateFormat(tt.name)
+        if (err == nil) != tt.ok || got != tt.want {
+            t.Errorf("resolveDateFormat(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+        }
+    }
+}
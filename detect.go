@@ -0,0 +1,280 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// TypeCandidate is a DEXA format considered for a header row, with how well
+// the header fits it
+type TypeCandidate struct {
+    Type    DXAType // Candidate format
+    Marker  bool    // The header has the format's distinctive column ("arms fat mass", ...)
+    Columns int     // Measurement columns of the header the format reads
+    Total   int     // Measurement columns in the header
+    Score   float64 // Confidence from 0 to 1: half for the marker, half for the share of columns
+}
+
+// String returns the candidate for display, e.g. "bodycomp 98%"
+func (c TypeCandidate) String() string {
+    return fmt.Sprintf("%s %d%%", dxaTypeKeys[c.Type], int(math.Round(c.Score*100)))
+}
+
+// DetectionError is returned for a header that matches no format, or the
+// distinctive columns of several. Candidates lists every format the header
+// partly fits, best first
+type DetectionError struct {
+    What       string          // "file" or "section"
+    Ambiguous  bool            // Several formats matched
+    Candidates []TypeCandidate // Ranked candidates
+}
+
+func (e *DetectionError) Error() string {
+    if e.Ambiguous {
+        matched := []string{}
+        for _, c := range e.Candidates {
+            if c.Marker {
+                matched = append(matched, c.String())
+            }
+        }
+        return fmt.Sprintf("ambiguous %s type: header matches %s; use --type to choose one", e.What, strings.Join(matched, ", "))
+    }
+    if len(e.Candidates) > 0 {
+        return fmt.Sprintf("unrecognized %s type (closest: %s; use --type to force it)", e.What, e.Candidates[0])
+    }
+    return fmt.Sprintf("unrecognized %s type", e.What)
+}
+
+// typeSignature describes how a built-in format is recognized
+type typeSignature struct {
+    t      DXAType
+    marker func(h string) bool // Reports whether the lowercase header has the distinctive column
+    claims func(c Column) bool // Reports whether the format reads a decoded header column
+}
+
+// femurHeaderRE matches a femoral neck BMD column such as "Left Neck BMD" or
+// "Femoral Neck Mean BMD"
+var femurHeaderRE = regexp.MustCompile(`\bneck\b[^\t]*\bbmd\b`)
+
+// forearmHeaderRE matches a radius or ulna BMD column such as "Radius 33% BMD"
+var forearmHeaderRE = regexp.MustCompile(`\b(radius|ulna)\b[^\t]*\bbmd\b`)
+
+// spineHeaderRE matches a lumbar vertebra BMD column such as "L1 BMD" or "L1-L4 BMD"
+var spineHeaderRE = regexp.MustCompile(`\bl[1-5]\b[^\t]*\bbmd\b`)
+
+// bodyCompMetrics are the metrics read by the Body Composition format
+var bodyCompMetrics = map[string]bool{
+    "Bone Mass": true, "Fat Mass": true, "Lean Mass": true, "Tissue Mass": true,
+    "Fat Free Mass": true, "Total Mass": true, "Region %Fat": true, "Tissue %Fat": true,
+    "%Fat": true,
+}
+
+// boneMetrics are the metrics of the bone density formats
+var boneMetrics = map[string]bool{
+    "BMD": true, "BMC": true, "Area": true, "T-Score": true, "Z-Score": true,
+    "Average Height": true, "Average Width": true,
+}
+
+// totalBodyRegions are the regions of a Total Body report
+var totalBodyRegions = map[string]bool{
+    "Head": true, "Arms": true, "Legs": true, "Arm": true, "Leg": true, "Trunk": true,
+    "Ribs": true, "Pelvis": true, "Spine": true, "Total": true, "TBLH": true,
+}
+
+// typeSignatures are the built-in formats, in the order they were added
+var typeSignatures = []typeSignature{
+    {
+        t:      DXATypeBodyComp,
+        marker: func(h string) bool { return strings.Contains(h, "arms fat mass") },
+        claims: func(c Column) bool { return bodyCompMetrics[c.Metric] || isHydrationKey(c.Key) },
+    },
+    {
+        t:      DXATypeTotalBody,
+        marker: func(h string) bool { return strings.Contains(h, "head bmd") },
+        claims: func(c Column) bool { return boneMetrics[c.Metric] && totalBodyRegions[c.Region] },
+    },
+    {
+        t:      DXATypeCoreScan,
+        marker: func(h string) bool { return strings.Contains(h, "vat mass") },
+        claims: func(c Column) bool { return c.Metric == "VAT Mass" || c.Metric == "VAT Volume" },
+    },
+    {
+        t:      DXATypeSpine,
+        marker: spineHeaderRE.MatchString,
+        claims: func(c Column) bool { return boneMetrics[c.Metric] && isVertebraRegion(c.Region) },
+    },
+    {
+        t:      DXATypeFemur,
+        marker: femurHeaderRE.MatchString,
+        claims: func(c Column) bool { return boneMetrics[c.Metric] && c.Region != "" && isFemurSite(c.Region) },
+    },
+    {
+        t:      DXATypeForearm,
+        marker: forearmHeaderRE.MatchString,
+        claims: func(c Column) bool {
+            _, _, ok := forearmSite(c.Region)
+            return boneMetrics[c.Metric] && c.Region != "" && ok
+        },
+    },
+}
+
+// isHydrationKey reports whether key is one of the body water columns
+func isHydrationKey(key string) bool {
+    for _, k := range hydrationKeys {
+        if key == k {
+            return true
+        }
+    }
+    return false
+}
+
+// isFemurSite reports whether a decoded region is a known hip site
+func isFemurSite(region string) bool {
+    site := femurSite(region)
+    for _, s := range femurSites {
+        if s == site {
+            return true
+        }
+    }
+    return false
+}
+
+// isVertebraRegion reports whether a decoded region is a vertebra or a range
+// of vertebrae ("L1", "L1-L4")
+func isVertebraRegion(region string) bool {
+    for _, v := range strings.Split(strings.ToLower(region), "-") {
+        if !vertebraRE.MatchString(v) {
+            return false
+        }
+    }
+    return true
+}
+
+// matchDXATypes returns the formats whose distinctive column appears in the
+// header, built-in formats first
+// Detection is based on distinctive column names unique to each format:
+// - BodyComp: contains "arms fat mass"
+// - TotalBody: contains "head bmd" (bone mineral density)
+// - CoreScan: contains "vat mass" (visceral adipose tissue)
+// - Spine: contains a lumbar vertebra BMD column ("l1 bmd", "l2-l4 bmd", ...)
+// - Femur: contains a femoral neck BMD column ("left neck bmd", ...)
+// - Forearm: contains a radius or ulna BMD column ("radius 33% bmd", ...)
+// - Spec formats: every detect pattern of the spec matches
+func matchDXATypes(header string) []DXAType {
+    h := strings.ToLower(header)
+    types := []DXAType{}
+    for _, s := range typeSignatures {
+        if s.marker(h) {
+            types = append(types, s.t)
+        }
+    }
+    for _, spec := range formatSpecs {
+        if spec.detects(header) {
+            types = append(types, spec.t)
+        }
+    }
+    return types
+}
+
+// scoreDXATypes scores every known format against the whole header row
+// A format scores 0.5 for its distinctive column plus up to 0.5 for the share
+// of measurement columns it reads, so a header that mixes formats shows how
+// much of it each one explains. Formats scoring 0 are left out; the rest are
+// returned best first
+func scoreDXATypes(header string) []TypeCandidate {
+    h := strings.ToLower(header)
+    cols := parseHeader(header)
+    total := 0
+    for _, c := range cols {
+        if c.Index >= 4 && c.Key != "" && !isDemographicKey(c.Key) {
+            total++
+        }
+    }
+
+    candidates := []TypeCandidate{}
+    score := func(t DXAType, marker bool, claims func(Column) bool) {
+        c := TypeCandidate{Type: t, Marker: marker, Total: total}
+        for _, col := range cols {
+            if col.Index >= 4 && col.Key != "" && !isDemographicKey(col.Key) && claims(col) {
+                c.Columns++
+            }
+        }
+        if marker {
+            c.Score = 0.5
+        }
+        if total > 0 {
+            c.Score += 0.5 * float64(c.Columns) / float64(total)
+        }
+        if c.Score > 0 {
+            candidates = append(candidates, c)
+        }
+    }
+    for _, s := range typeSignatures {
+        score(s.t, s.marker(h), s.claims)
+    }
+    for _, spec := range formatSpecs {
+        score(spec.t, spec.detects(header), spec.claims)
+    }
+
+    sort.SliceStable(candidates, func(i, j int) bool {
+        return candidates[i].Score > candidates[j].Score
+    })
+    return candidates
+}
+
+// detectDXAType examines the header row to determine which DEXA format it holds
+// Exactly one format must have its distinctive column (see matchDXATypes);
+// otherwise a DetectionError describes the candidates. A forced type (--type)
+// is used as given. what ("file" or "section") is used in error messages
+func detectDXAType(header string, forced DXAType, what string) (DXAType, []TypeCandidate, error) {
+    candidates := scoreDXATypes(header)
+    if forced != DXATypeUnknown {
+        return forced, candidates, nil
+    }
+
+    matched := []TypeCandidate{}
+    for _, c := range candidates {
+        if c.Marker {
+            matched = append(matched, c)
+        }
+    }
+    switch len(matched) {
+    case 0:
+        return DXATypeUnknown, candidates, &DetectionError{What: what, Candidates: candidates}
+    case 1:
+        return matched[0].Type, candidates, nil
+    }
+    return DXATypeUnknown, candidates, &DetectionError{What: what, Ambiguous: true, Candidates: candidates}
+}
+
+// lookupDXAType returns the format named by a --type value: a built-in key
+// such as "bodycomp" or the name of a spec format
+// "auto" and "" return DXATypeUnknown so the type is detected from the header
+func lookupDXAType(name string) (DXAType, error) {
+    name = strings.ToLower(strings.TrimSpace(name))
+    if name == "" || name == "auto" {
+        return DXATypeUnknown, nil
+    }
+    for t, key := range dxaTypeKeys {
+        if key == name {
+            return t, nil
+        }
+    }
+    return DXATypeUnknown, fmt.Errorf("invalid type %q: use %s", name, strings.Join(typeKeys(), ", "))
+}
+
+// typeKeys lists the values accepted by --type: auto, the built-in formats and
+// the spec formats
+func typeKeys() []string {
+    keys := []string{"auto"}
+    for _, s := range typeSignatures {
+        keys = append(keys, dxaTypeKeys[s.t])
+    }
+    for _, spec := range formatSpecs {
+        keys = append(keys, spec.Name)
+    }
+    return keys
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Diagnostic actions: what the parser did with a problematic row
+const (
+    ActionSkipped  = "skipped"  // Row was dropped from the output
+    ActionRepaired = "repaired" // Row was kept after working around the problem
+)
+
+// excerptLen is the maximum number of characters of a raw row kept in a diagnostic
+const excerptLen = 120
+
+// Diagnostic describes a problem found on one line of the input
+// Diagnostics are collected by RecordReader and can be written as a JSON or CSV
+// sidecar so the source export can be corrected
+type Diagnostic struct {
+    File    string `json:"file,omitempty"` // Archive member the line belongs to, if any
+    Line    int    `json:"line"`           // 1-based line number in the input file
+    Reason  string `json:"reason"`         // What was wrong with the row
+    Excerpt string `json:"excerpt"`        // Start of the raw row text
+    Action  string `json:"action"`         // ActionSkipped or ActionRepaired
+}
+
+// newDiagnostic builds a diagnostic with a shortened excerpt of the raw row
+// Tabs are shown as " | " so the excerpt stays readable in a single cell
+func newDiagnostic(line int, reason, raw, action string) Diagnostic {
+    excerpt := strings.ReplaceAll(strings.TrimSpace(raw), "\t", " | ")
+    if r := []rune(excerpt); len(r) > excerptLen {
+        excerpt = string(r[:excerptLen]) + "..."
+    }
+    return Diagnostic{Line: line, Reason: reason, Excerpt: excerpt, Action: action}
+}
+
+// countDiagnostics returns the number of skipped and repaired rows
+func countDiagnostics(diags []Diagnostic) (skipped, repaired int) {
+    for _, d := range diags {
+        switch d.Action {
+        case ActionSkipped:
+            skipped++
+        case ActionRepaired:
+            repaired++
+        }
+    }
+    return skipped, repaired
+}
+
+// WriteDiagnostics writes the diagnostic report in the given format ("json" or "csv")
+func WriteDiagnostics(w io.Writer, format string, diags []Diagnostic) error {
+    switch format {
+    case "json":
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        if diags == nil {
+            diags = []Diagnostic{} // Encode as [] rather than null
+        }
+        return enc.Encode(diags)
+
+    case "csv":
+        // The File column is only there for the diagnostics of archive members
+        files := false
+        for _, d := range diags {
+            files = files || d.File != ""
+        }
+        writer := csv.NewWriter(w)
+        header := []string{"Line", "Action", "Reason", "Excerpt"}
+        if files {
+            header = append([]string{"File"}, header...)
+        }
+        writer.Write(header)
+        for _, d := range diags {
+            row := []string{strconv.Itoa(d.Line), d.Action, d.Reason, d.Excerpt}
+            if files {
+                row = append([]string{d.File}, row...)
+            }
+            writer.Write(row)
+        }
+        writer.Flush()
+        return writer.Error()
+    }
+    return fmt.Errorf("unknown diagnostics format %q", format)
+}
+
+// writeDiagnosticsFile writes the diagnostic report to path, or to standard
+// output when path is "-"
+// The format follows the file extension: .csv for CSV, anything else for JSON
+func writeDiagnosticsFile(path string, diags []Diagnostic) error {
+    format := "json"
+    if strings.EqualFold(filepath.Ext(path), ".csv") {
+        format = "csv"
+    }
+    if path == stdioPath {
+        return WriteDiagnostics(os.Stdout, format, diags)
+    }
+
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    if err := WriteDiagnostics(f, format, diags); err != nil {
+        return err
+    }
+    return f.Close()
+}
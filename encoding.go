@@ -0,0 +1,189 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "unicode/utf8"
+
+    "golang.org/x/text/encoding"
+    "golang.org/x/text/encoding/charmap"
+    "golang.org/x/text/encoding/unicode"
+    "golang.org/x/text/transform"
+)
+
+// sniffSize is the number of leading bytes examined when guessing the encoding
+const sniffSize = 4096
+
+// inputEncoding describes one supported input encoding
+type inputEncoding struct {
+    name     string            // Value accepted by --encoding
+    label    string            // Human-readable name shown in --dry-run
+    encoding encoding.Encoding // Decoder factory
+}
+
+// inputEncodings lists the encodings that can be detected or forced with --encoding
+// The UTF-16 decoders honor a BOM when present and fall back to the named byte order
+var inputEncodings = []inputEncoding{
+    {"utf-8", "UTF-8", unicode.UTF8BOM},
+    {"utf-16le", "UTF-16 LE", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)},
+    {"utf-16be", "UTF-16 BE", unicode.UTF16(unicode.BigEndian, unicode.UseBOM)},
+    {"windows-1252", "Windows-1252", charmap.Windows1252},
+}
+
+// encodingAliases maps alternative spellings to the names in inputEncodings
+var encodingAliases = map[string]string{
+    "utf8":    "utf-8",
+    "utf16le": "utf-16le",
+    "utf16be": "utf-16be",
+    "utf-16":  "utf-16le",
+    "utf16":   "utf-16le",
+    "cp1252":  "windows-1252",
+    "latin1":  "windows-1252",
+}
+
+// validEncoding reports whether name is "auto" or a supported encoding
+func validEncoding(name string) bool {
+    _, ok := lookupEncoding(name)
+    return ok || strings.EqualFold(name, "auto") || name == ""
+}
+
+// lookupEncoding finds a supported encoding by name or alias (case-insensitive)
+func lookupEncoding(name string) (inputEncoding, bool) {
+    n := strings.ToLower(strings.TrimSpace(name))
+    if alias, ok := encodingAliases[n]; ok {
+        n = alias
+    }
+    for _, e := range inputEncodings {
+        if e.name == n {
+            return e, true
+        }
+    }
+    return inputEncoding{}, false
+}
+
+// decodeInput wraps r in a decoder that produces UTF-8 text
+// name selects the encoding; "auto" or "" detects it from the byte order mark,
+// or failing that from the byte pattern of the first few KiB
+// Returns the decoded reader and a description of the encoding for reporting
+func decodeInput(r io.Reader, name string) (io.Reader, string, error) {
+    br := bufio.NewReaderSize(r, sniffSize)
+
+    if name != "" && !strings.EqualFold(name, "auto") {
+        e, ok := lookupEncoding(name)
+        if !ok {
+            return nil, "", fmt.Errorf("unsupported encoding %q", name)
+        }
+        return transform.NewReader(br, e.encoding.NewDecoder()), e.label, nil
+    }
+
+    // Peek never consumes input; a short read just means a small file
+    sample, err := br.Peek(sniffSize)
+    if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+        return nil, "", err
+    }
+
+    e, label := sniffEncoding(sample)
+    return transform.NewReader(br, e.encoding.NewDecoder()), label, nil
+}
+
+// readInput returns the UTF-8 text of an input: the rows of a sheet of an XLSX
+// workbook (see ReadXLSXSheet), or text decoded as by decodeInput. The
+// description is the encoding, or the workbook sheet read
+// A workbook is read in place when r is a file, otherwise into memory
+func readInput(r io.Reader, encoding, sheet string) (io.Reader, string, error) {
+    br := bufio.NewReaderSize(r, sniffSize)
+    if !looksLikeZip(br) {
+        if sheet != "" {
+            return nil, "", fmt.Errorf("--sheet applies to XLSX workbooks only")
+        }
+        return decodeInput(br, encoding)
+    }
+
+    var ra io.ReaderAt
+    var size int64
+    if f, ok := r.(*os.File); ok && isRegularFile(f) {
+        info, err := f.Stat()
+        if err != nil {
+            return nil, "", err
+        }
+        ra, size = f, info.Size()
+    } else {
+        data, err := io.ReadAll(br)
+        if err != nil {
+            return nil, "", err
+        }
+        ra, size = bytes.NewReader(data), int64(len(data))
+    }
+    text, name, err := ReadXLSXSheet(ra, size, sheet)
+    if err != nil {
+        return nil, "", err
+    }
+    return text, fmt.Sprintf("XLSX workbook, sheet %q", name), nil
+}
+
+// isRegularFile reports whether f is a regular file, which can be read at
+// random, rather than standard input, a pipe or a device
+func isRegularFile(f *os.File) bool {
+    info, err := f.Stat()
+    return err == nil && info.Mode().IsRegular()
+}
+
+// sniffEncoding guesses the encoding of a sample of raw input bytes
+// Order of checks:
+// 1. Byte order mark (UTF-8, UTF-16 LE, UTF-16 BE)
+// 2. NUL byte pattern: mostly-ASCII UTF-16 text has a zero in every other byte
+// 3. Valid UTF-8, otherwise Windows-1252 (legacy Excel/Notepad "ANSI" saves)
+func sniffEncoding(sample []byte) (inputEncoding, string) {
+    utf8Enc, _ := lookupEncoding("utf-8")
+    le, _ := lookupEncoding("utf-16le")
+    be, _ := lookupEncoding("utf-16be")
+    ansi, _ := lookupEncoding("windows-1252")
+
+    switch {
+    case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+        return utf8Enc, "UTF-8 (BOM)"
+    case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+        return le, "UTF-16 LE (BOM)"
+    case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+        return be, "UTF-16 BE (BOM)"
+    }
+
+    // Count NUL bytes at even and odd offsets
+    even, odd := 0, 0
+    for i, b := range sample {
+        if b != 0 {
+            continue
+        }
+        if i%2 == 0 {
+            even++
+        } else {
+            odd++
+        }
+    }
+    pairs := len(sample) / 2
+    if pairs > 0 {
+        // ASCII in UTF-16 LE is "x\x00", in UTF-16 BE "\x00x"
+        if odd > pairs/4 && odd > even*4 {
+            return le, "UTF-16 LE (no BOM, detected)"
+        }
+        if even > pairs/4 && even > odd*4 {
+            return be, "UTF-16 BE (no BOM, detected)"
+        }
+    }
+
+    // The sample may end in the middle of a multi-byte character; ignore a
+    // truncated final sequence of up to 3 bytes when validating
+    check := sample
+    for i := 0; i < 3 && len(check) > 0 && !utf8.Valid(check); i++ {
+        check = check[:len(check)-1]
+    }
+    if utf8.Valid(check) {
+        return utf8Enc, "UTF-8 (detected)"
+    }
+
+    return ansi, "Windows-1252 (detected)"
+}
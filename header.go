@@ -0,0 +1,474 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Column describes a single column of the header row
+// Data cells are mapped to columns by position, and each column carries the
+// (region, metric, side) identity decoded from its header name, so a missing
+// or extra column only ever affects its own value
+type Column struct {
+    Index  int    // Position of the column in the tab-delimited row
+    Name   string // Original header text, e.g. "Arms Fat Mass Left"
+    Region string // Body region, e.g. "Arms", "Android", "Total"
+    Metric string // Measurement type, e.g. "Fat Mass", "Region %Fat"
+    Side   string // "Left", "Right", "Delta", or "" for the combined value
+    Unit   string // Unit from the header's parenthetical, e.g. "g/cm²"; cells may override it
+    Key    string // Normalized identity, e.g. "Arm_Left_BMD"; unique within the header
+}
+
+// metricNames lists the measurement types recognized in header names
+// Each entry maps the normalized words to the display name used in output
+// Longer phrases come first so "fat free mass" wins over "fat mass"
+var metricNames = []struct {
+    words string
+    name  string
+}{
+    {"region percent fat", "Region %Fat"},
+    {"tissue percent fat", "Tissue %Fat"},
+    {"percent fat", "%Fat"},
+    {"average height", "Average Height"},
+    {"average width", "Average Width"},
+    {"fat free mass", "Fat Free Mass"},
+    {"bone mass", "Bone Mass"},
+    {"fat mass", "Fat Mass"},
+    {"lean mass", "Lean Mass"},
+    {"tissue mass", "Tissue Mass"},
+    {"total mass", "Total Mass"},
+    {"vat mass", "VAT Mass"},
+    {"vat volume", "VAT Volume"},
+    {"t score", "T-Score"},
+    {"z score", "Z-Score"},
+    {"bmd", "BMD"},
+    {"bmc", "BMC"},
+    {"area", "Area"},
+}
+
+// sideNames maps the side qualifiers found in header names to their display name
+// The combined (total) value of a region has no side qualifier
+var sideNames = map[string]string{
+    "left":       "Left",
+    "l":          "Left",
+    "right":      "Right",
+    "r":          "Right",
+    "mean":       "Mean",
+    "delta":      "Delta",
+    "diff":       "Delta",
+    "difference": "Delta",
+}
+
+// regionNames maps lowercase region words to their canonical spelling
+// Unknown regions are title-cased as they appear in the header
+var regionNames = map[string]string{
+    "tblh": "TBLH",
+}
+
+// femurSites maps the normalized words of a hip region to its site name
+// "Femur", "Femoral" and "Hip" are dropped from the region first, so
+// "Femoral Neck" is Neck and "Total Hip" is Total
+var femurSites = map[string]string{
+    "neck":               "Neck",
+    "fn":                 "Neck",
+    "troch":              "Trochanter",
+    "trochanter":         "Trochanter",
+    "greater trochanter": "Trochanter",
+    "shaft":              "Shaft",
+    "ward":               "Ward's Triangle",
+    "wards":              "Ward's Triangle",
+    "ward triangle":      "Ward's Triangle",
+    "wards triangle":     "Ward's Triangle",
+    "total":              "Total",
+    "":                   "Total",
+}
+
+// forearmBones maps the bone words that start a forearm region to their name
+var forearmBones = map[string]string{
+    "radius": "Radius",
+    "ulna":   "Ulna",
+    "both":   "Both",
+}
+
+// forearmSites maps the normalized words of a forearm site to its display name
+// and the friendlier form used in keys; a bone without a site is its total
+var forearmSites = map[string]struct {
+    name  string
+    label string
+}{
+    "33 percent":   {"33%", "33pct"},
+    "33":           {"33%", "33pct"},
+    "33pct":        {"33%", "33pct"},
+    "1 3":          {"33%", "33pct"},
+    "one third":    {"33%", "33pct"},
+    "mid":          {"Mid", "Mid"},
+    "middle":       {"Mid", "Mid"},
+    "ud":           {"Ultra-Distal", "UltraDistal"},
+    "ultra distal": {"Ultra-Distal", "UltraDistal"},
+    "ultradistal":  {"Ultra-Distal", "UltraDistal"},
+    "total":        {"Total", "Total"},
+    "":             {"Total", "Total"},
+}
+
+// vertebraRE matches a vertebra label such as "l1" or "t12" in header words
+var vertebraRE = regexp.MustCompile(`^[ltcs][0-9]{1,2}$`)
+
+// hydrationNames maps the normalized words of the body water columns some Body
+// Composition exports append to their key; the columns are read by key into
+// BodyFatRecord.Hydration
+var hydrationNames = map[string]string{
+    "tbw":                     "TBW",
+    "total body water":        "TBW",
+    "icw":                     "ICW",
+    "intracellular water":     "ICW",
+    "ecw":                     "ECW",
+    "extracellular water":     "ECW",
+    "tbw device":              "TBW_Device",
+    "total body water device": "TBW_Device",
+}
+
+// hydrationKeys lists the hydration keys in output order
+var hydrationKeys = []string{"TBW", "ICW", "ECW", "TBW_Device"}
+
+// demographicNames maps the normalized words of the patient detail columns some
+// exports place between the IDs and the measurements to their key; the columns
+// are read by key into the record's Demographics block
+var demographicNames = map[string]string{
+    "age":           "Age",
+    "age at scan":   "Age",
+    "sex":           "Sex",
+    "gender":        "Sex",
+    "height":        "Height",
+    "weight":        "Weight",
+    "ethnicity":     "Ethnicity",
+    "ethnic group":  "Ethnicity",
+    "race":          "Ethnicity",
+    "birth date":    "Birth_Date",
+    "birthdate":     "Birth_Date",
+    "date of birth": "Birth_Date",
+    "dob":           "Birth_Date",
+}
+
+// demographicKeys lists the demographic keys in output order
+var demographicKeys = []string{"Age", "Sex", "Height", "Weight", "Ethnicity", "Birth_Date"}
+
+// isDemographicKey reports whether key is one of the patient detail columns
+func isDemographicKey(key string) bool {
+    for _, k := range demographicKeys {
+        if key == k {
+            return true
+        }
+    }
+    return false
+}
+
+// parseHeader tokenizes the header row into columns
+// The first four columns are the common ID/date fields; every other column is
+// decoded into its (region, metric, side) identity. Columns whose name does not
+// contain a known metric are kept with an empty Metric so callers can skip them
+func parseHeader(header string) []Column {
+    fields := strings.Split(header, "\t")
+    cols := make([]Column, len(fields))
+
+    // Number of times each key has been used, to keep keys unique
+    keys := map[string]int{}
+
+    for i, f := range fields {
+        name := strings.TrimSpace(f)
+        cols[i] = Column{Index: i, Name: name}
+        if i < 4 || name == "" {
+            continue // ID1, ID2, ID3, Date, or a blank header cell
+        }
+
+        c := &cols[i]
+        c.Region, c.Metric, c.Side = decodeColumnName(name)
+        c.Unit = headerUnit(name)
+        if c.Unit == "" && strings.Contains(c.Metric, "%") {
+            c.Unit = "%" // "Region %Fat" names its unit in the metric itself
+        }
+
+        // Build the key from the decoded identity so that equivalent spellings
+        // ("Arm Left BMD", "Left Arm BMD (g/cm²)") normalize to the same key
+        if c.Metric != "" {
+            c.Key = sanitizeColumnName(strings.Join(strings.Fields(c.Region+" "+c.Side+" "+c.Metric), " "))
+        } else if key, ok := hydrationNames[strings.Join(headerWords(name), " ")]; ok {
+            c.Key = key // "Total Body Water (L)" and "TBW" are the same column
+        } else if key, ok := demographicNames[strings.Join(headerWords(name), " ")]; ok {
+            c.Key = key // "Date of Birth", "DOB" and "Birth Date" are the same column
+        } else {
+            c.Key = sanitizeColumnName(stripParenthetical(name))
+        }
+
+        keys[c.Key]++
+        if n := keys[c.Key]; n > 1 {
+            c.Key = fmt.Sprintf("%s_%d", c.Key, n)
+        }
+    }
+
+    return cols
+}
+
+// decodeColumnName splits a header name into region, metric and side
+// Examples: "Arms Fat Mass Left"  -> ("Arms", "Fat Mass", "Left")
+//           "Arm Left BMD"        -> ("Arm", "BMD", "Left")
+//           "Total Region %Fat"   -> ("Total", "Region %Fat", "")
+//           "L1–L4 BMD (g/cm²)"   -> ("L1-L4", "BMD", "")
+// Returns an empty metric when no known measurement type is found
+func decodeColumnName(name string) (region, metric, side string) {
+    words := headerWords(name)
+
+    // Locate the known metric phrase in the name (longest phrases are tried first)
+    start, end := -1, -1
+    for _, m := range metricNames {
+        mw := strings.Fields(m.words)
+        if i := indexWords(words, mw); i >= 0 {
+            start, end, metric = i, i+len(mw), m.name
+            break
+        }
+    }
+    if metric == "" {
+        return "", "", ""
+    }
+
+    // Words after the metric may only be side qualifiers ("Left", "Total", ...)
+    for _, w := range words[end:] {
+        if s, ok := sideNames[w]; ok {
+            side = s
+            continue
+        }
+        if w == "total" {
+            continue // Explicit combined value
+        }
+        return "", "", "" // Unexpected trailing text, not a measurement column
+    }
+
+    // Words before the metric form the region, with embedded side qualifiers
+    // such as "Arm Left" pulled out into the side
+    regionWords := []string{}
+    for _, w := range words[:start] {
+        if s, ok := sideNames[w]; ok && side == "" {
+            side = s
+            continue
+        }
+        regionWords = append(regionWords, canonicalRegion(w))
+    }
+    region = strings.Join(regionWords, " ")
+    if r, ok := vertebraRange(words[:start]); ok {
+        region = r
+    }
+
+    return region, metric, side
+}
+
+// headerWords normalizes a header name into lowercase words
+// Punctuation is turned into spaces and "%" becomes the word "percent",
+// so "Region %Fat" and "region_percent_fat" produce the same words
+func headerWords(name string) []string {
+    // Drop any parenthetical (units such as "(lbs)" or "(g/cm²)")
+    name = strings.ToLower(stripParenthetical(name))
+
+    name = strings.ReplaceAll(name, "%", " percent ")
+    replacer := strings.NewReplacer("-", " ", "–", " ", "—", " ", "_", " ", "/", " ", ":", " ", ".", " ")
+    return strings.Fields(replacer.Replace(name))
+}
+
+// stripParenthetical removes every "(...)" group from a header name
+func stripParenthetical(name string) string {
+    for {
+        open := strings.Index(name, "(")
+        if open < 0 {
+            return strings.TrimSpace(name)
+        }
+        close := strings.Index(name[open:], ")")
+        if close < 0 {
+            return strings.TrimSpace(name[:open])
+        }
+        name = name[:open] + " " + name[open+close+1:]
+    }
+}
+
+// headerUnit returns the normalized unit found in a header's parenthetical
+// Example: "Head BMD (g/cm2)" -> "g/cm²"; returns "" when there is none
+func headerUnit(name string) string {
+    open := strings.LastIndex(name, "(")
+    if open < 0 {
+        return ""
+    }
+    close := strings.Index(name[open:], ")")
+    if close < 0 {
+        return ""
+    }
+    return normalizeUnit(name[open+1 : open+close])
+}
+
+// normalizeUnit maps the spellings of a unit found in exports to one canonical form
+// Unknown units are returned trimmed but otherwise unchanged
+func normalizeUnit(u string) string {
+    u = strings.TrimSpace(u)
+    switch strings.ToLower(u) {
+    case "g", "gm", "gram", "grams":
+        return "g"
+    case "kg", "kgs", "kilogram", "kilograms":
+        return "kg"
+    case "lb", "lbs", "pound", "pounds":
+        return "lbs"
+    case "%", "percent", "pct":
+        return "%"
+    case "g/cm²", "g/cm2", "g/cm^2", "g/sq cm":
+        return "g/cm²"
+    case "cm²", "cm2", "cm^2", "sq cm":
+        return "cm²"
+    case "in³", "in3", "in^3", "cu in":
+        return "in³"
+    case "cm³", "cm3", "cm^3", "cu cm", "cc":
+        return "cm³"
+    case "l", "liter", "liters", "litre", "litres":
+        return "L"
+    case "cm", "centimeter", "centimeters", "centimetre", "centimetres":
+        return "cm"
+    case "in", "inch", "inches":
+        return "in"
+    case "y", "yr", "yrs", "year", "years":
+        return "years"
+    }
+    return u
+}
+
+// knownUnits is the set of canonical units produced by normalizeUnit
+var knownUnits = map[string]bool{
+    "g": true, "kg": true, "lbs": true, "%": true, "g/cm²": true, "cm²": true, "in³": true, "cm³": true, "L": true,
+    "cm": true, "in": true, "years": true,
+}
+
+// isKnownUnit reports whether u is a recognized spelling of a unit
+func isKnownUnit(u string) bool {
+    return knownUnits[normalizeUnit(u)]
+}
+
+// femurSite returns the canonical hip site for a decoded header region
+// Unknown sites are returned unchanged
+func femurSite(region string) string {
+    words := []string{}
+    for _, w := range strings.Fields(strings.ToLower(strings.ReplaceAll(region, "'", ""))) {
+        if w != "femur" && w != "femoral" && w != "hip" {
+            words = append(words, w)
+        }
+    }
+    if site, ok := femurSites[strings.Join(words, " ")]; ok {
+        return site
+    }
+    return region
+}
+
+// forearmColumns gives Forearm columns their canonical site and friendly key
+// Example: "Radius 1/3 BMD" -> Region "Radius 33%", Key "Radius_33pct_BMD"
+// Columns whose site is unknown keep the region and key derived from their
+// header text, so they are still written under a recognizable label
+func forearmColumns(cols []Column) {
+    for i := range cols {
+        c := &cols[i]
+        if c.Index < 4 || c.Key == "" {
+            continue // ID/date field or blank header cell
+        }
+
+        if region, label, ok := forearmSite(c.Region); ok && c.Metric != "" {
+            c.Region = region
+            c.Key = sanitizeColumnName(strings.Join(strings.Fields(label+" "+c.Side+" "+c.Metric), " "))
+        }
+    }
+    uniqueKeys(cols)
+}
+
+// uniqueKeys numbers repeated keys after columns have been renamed, as
+// parseHeader does: Radius_33pct_BMD, Radius_33pct_BMD_2, ...
+func uniqueKeys(cols []Column) {
+    keys := map[string]int{}
+    for i := range cols {
+        c := &cols[i]
+        if c.Key == "" {
+            continue
+        }
+        keys[c.Key]++
+        if n := keys[c.Key]; n > 1 {
+            c.Key = fmt.Sprintf("%s_%d", c.Key, n)
+        }
+    }
+}
+
+// forearmSite splits a decoded forearm region into bone and site
+// Returns the display region ("Radius 33%"), the key label ("Radius 33pct")
+// and false when the site is not recognized
+func forearmSite(region string) (string, string, bool) {
+    words := []string{}
+    for _, w := range strings.Fields(strings.ToLower(region)) {
+        if w != "forearm" && w != "and" && w != "+" && w != "&" {
+            words = append(words, w)
+        }
+    }
+
+    bone := ""
+    if len(words) > 0 {
+        if b, ok := forearmBones[words[0]]; ok {
+            bone = b
+            words = words[1:]
+            if bone == "Radius" && len(words) > 0 && words[0] == "ulna" {
+                bone = "Both" // "Radius and Ulna"
+                words = words[1:]
+            }
+        }
+    }
+
+    site, ok := forearmSites[strings.Join(words, " ")]
+    if !ok {
+        return "", "", false
+    }
+    return strings.TrimSpace(bone + " " + site.name), strings.TrimSpace(bone + " " + site.label), true
+}
+
+// vertebraRange joins region words naming a vertebra or a range of vertebrae
+// Examples: ["l2"] -> "L2", ["l1", "l4"] -> "L1-L4", ["l2", "4"] -> "L2-L4"
+// Returns false when the words are not vertebra labels
+func vertebraRange(words []string) (string, bool) {
+    if len(words) == 0 || len(words) > 2 || !vertebraRE.MatchString(words[0]) {
+        return "", false
+    }
+    from := strings.ToUpper(words[0])
+    if len(words) == 1 {
+        return from, true
+    }
+
+    to := words[1]
+    if _, err := strconv.Atoi(to); err == nil {
+        to = from[:1] + to // "L1-4" is shorthand for L1-L4
+    } else if !vertebraRE.MatchString(to) {
+        return "", false
+    }
+    return from + "-" + strings.ToUpper(to), true
+}
+
+// indexWords returns the position of the phrase within words, or -1
+func indexWords(words, phrase []string) int {
+    for i := 0; i+len(phrase) <= len(words); i++ {
+        match := true
+        for j := range phrase {
+            if words[i+j] != phrase[j] {
+                match = false
+                break
+            }
+        }
+        if match {
+            return i
+        }
+    }
+    return -1
+}
+
+// canonicalRegion returns the display spelling of a lowercase region word
+func canonicalRegion(w string) string {
+    if name, ok := regionNames[w]; ok {
+        return name
+    }
+    return strings.ToUpper(w[:1]) + w[1:]
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+    "bytes"
+    "io"
+    "strings"
+)
+
+// lineReadSize is the number of bytes read from the input at a time
+const lineReadSize = 64 * 1024
+
+// lineReader splits UTF-8 text into lines, like bufio.Scanner with ScanLines,
+// but without a limit on the line length and with LF, CRLF and bare CR (old
+// Mac and some Windows tools) all ending a line. Mixed endings in one file are
+// fine; each ending counts as exactly one line, so line numbers match what an
+// editor shows
+type lineReader struct {
+    r     io.Reader
+    chunk []byte // Read buffer
+    buf   []byte // Unconsumed part of chunk
+    line  []byte // Last line read, without its ending
+    num   int    // Number of the last line read (1-based)
+    cr    bool   // The last line ended with a CR at the end of chunk: skip a following LF
+    err   error  // First read error, io.EOF at the end of the input
+    queue []queuedLine // Lines put back by Unread, returned again by Scan
+}
+
+// queuedLine is a line read ahead and put back, with its line number
+type queuedLine struct {
+    text string
+    num  int
+}
+
+// newLineReader returns a lineReader reading from r
+func newLineReader(r io.Reader) *lineReader {
+    return &lineReader{r: r, chunk: make([]byte, lineReadSize)}
+}
+
+// Scan advances to the next line, which is then available through Text
+// Returns false at the end of the input or on a read error (see Err)
+// The last line doesn't need a line ending
+func (lr *lineReader) Scan() bool {
+    lr.line = lr.line[:0]
+    if len(lr.queue) > 0 {
+        lr.line = append(lr.line, lr.queue[0].text...)
+        lr.num = lr.queue[0].num
+        lr.queue = lr.queue[1:]
+        return true
+    }
+    started := false // Bytes of the line have been consumed
+    for {
+        // The LF of a CRLF split across two reads belongs to the previous line
+        if lr.cr && len(lr.buf) > 0 {
+            if lr.buf[0] == '\n' {
+                lr.buf = lr.buf[1:]
+            }
+            lr.cr = false
+        }
+
+        if i := bytes.IndexAny(lr.buf, "\r\n"); i >= 0 {
+            lr.line = append(lr.line, lr.buf[:i]...)
+            if lr.buf[i] == '\r' {
+                if i+1 < len(lr.buf) {
+                    if lr.buf[i+1] == '\n' {
+                        i++ // CRLF
+                    }
+                } else {
+                    lr.cr = true // Decided by the next read
+                }
+            }
+            lr.buf = lr.buf[i+1:]
+            lr.num++
+            return true
+        }
+        lr.line = append(lr.line, lr.buf...)
+        started = started || len(lr.buf) > 0
+        lr.buf = nil
+
+        if lr.err != nil {
+            // A final line without a line ending
+            if started {
+                lr.num++
+                return true
+            }
+            return false
+        }
+        n, err := lr.r.Read(lr.chunk)
+        lr.buf = lr.chunk[:n]
+        lr.err = err
+    }
+}
+
+// Unread puts lines read ahead back in front of the input, in order, so Scan
+// returns them again with their line numbers. They must be the lines Scan
+// returned last
+func (lr *lineReader) Unread(lines []queuedLine) {
+    lr.queue = append(append([]queuedLine{}, lines...), lr.queue...)
+    if len(lr.queue) > 0 {
+        lr.num = lr.queue[0].num - 1
+    }
+}
+
+// Text returns the last line read by Scan, without its line ending
+func (lr *lineReader) Text() string {
+    return string(lr.line)
+}
+
+// Line returns the number of the last line read (1-based)
+func (lr *lineReader) Line() int {
+    return lr.num
+}
+
+// Err returns the first read error, or nil at the end of the input
+func (lr *lineReader) Err() error {
+    if lr.err == io.EOF {
+        return nil
+    }
+    return lr.err
+}
+
+// delimiters are the field separators recognized in a header row, in order of
+// preference when several split it into the same number of fields
+var delimiters = []byte{'\t', ',', ';'}
+
+// delimiterNames are the display names of the delimiters
+var delimiterNames = map[byte]string{'\t': "tab", ',': "comma", ';': "semicolon"}
+
+// detectDelimiter returns the separator that splits a header row into the most
+// fields. Tab-delimited scanner exports keep tabs; copies re-saved from a
+// spreadsheet use commas, or semicolons where the comma is the decimal mark
+func detectDelimiter(line string) byte {
+    best, most := delimiters[0], 0
+    for _, d := range delimiters {
+        if fields, _ := splitFields(line, d); len(fields) > most {
+            best, most = d, len(fields)
+        }
+    }
+    return best
+}
+
+// splitFields splits a line at delim, following RFC 4180 quoting: a field that
+// starts with a double quote runs to the matching closing quote, may contain the
+// delimiter and line breaks, and writes a literal quote as "". Quotes inside an
+// unquoted field are kept as they are
+// Returns true when the line ends inside a quoted field, which then continues
+// on the next line
+func splitFields(line string, delim byte) ([]string, bool) {
+    fields := []string{}
+    var field strings.Builder
+    quoted := false // Inside a quoted field
+    start := true   // At the start of a field
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quoted && c == '"':
+            if i+1 < len(line) && line[i+1] == '"' {
+                field.WriteByte('"') // Escaped quote
+                i++
+            } else {
+                quoted = false
+            }
+        case quoted:
+            field.WriteByte(c)
+        case c == delim:
+            fields = append(fields, field.String())
+            field.Reset()
+            start = true
+            continue
+        case c == '"' && start:
+            quoted = true
+        default:
+            field.WriteByte(c)
+        }
+        start = false
+    }
+    return append(fields, field.String()), quoted
+}
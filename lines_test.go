@@ -0,0 +1,201 @@
+package main
+
+import (
+    "errors"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/iotest"
+)
+
+// scanAll returns the lines and line numbers read by a lineReader
+func scanAll(lr *lineReader) ([]string, []int) {
+    lines, nums := []string{}, []int{}
+    for lr.Scan() {
+        lines = append(lines, lr.Text())
+        nums = append(nums, lr.Line())
+    }
+    return lines, nums
+}
+
+func TestLineReaderEndings(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+        want  []string
+    }{
+        {"empty input", "", []string{}},
+        {"LF", "a\nb\n", []string{"a", "b"}},
+        {"CRLF", "a\r\nb\r\n", []string{"a", "b"}},
+        {"bare CR", "a\rb\r", []string{"a", "b"}},
+        {"mixed endings", "a\r\nb\rc\nd", []string{"a", "b", "c", "d"}},
+        {"empty lines", "a\r\n\r\n\rb\n\n", []string{"a", "", "", "b", ""}},
+        {"final line without ending", "a\nb", []string{"a", "b"}},
+        {"final CR", "a\r", []string{"a"}},
+        {"only a line ending", "\n", []string{""}},
+        {"CR then LF line", "a\r\n\nb", []string{"a", "", "b"}},
+    }
+
+    for _, tt := range tests {
+        // One byte at a time, every CR ends a chunk and its LF comes with the next read
+        readers := map[string]func() io.Reader{
+            "whole":    func() io.Reader { return strings.NewReader(tt.input) },
+            "one byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(tt.input)) },
+        }
+        for kind, reader := range readers {
+            lr := newLineReader(reader())
+            lines, nums := scanAll(lr)
+            if !reflect.DeepEqual(lines, tt.want) {
+                t.Errorf("%s (%s): lines = %q, want %q", tt.name, kind, lines, tt.want)
+            }
+            for i, n := range nums {
+                if n != i+1 {
+                    t.Errorf("%s (%s): line %q numbered %d, want %d", tt.name, kind, lines[i], n, i+1)
+                }
+            }
+            if err := lr.Err(); err != nil {
+                t.Errorf("%s (%s): Err() = %v", tt.name, kind, err)
+            }
+        }
+    }
+}
+
+func TestLineReaderLongLine(t *testing.T) {
+    long := strings.Repeat("x", lineReadSize*2+10)
+    lines, _ := scanAll(newLineReader(strings.NewReader(long + "\r\n" + "y")))
+    if len(lines) != 2 || lines[0] != long || lines[1] != "y" {
+        t.Errorf("got %d lines, want the long line and \"y\"", len(lines))
+    }
+}
+
+func TestLineReaderError(t *testing.T) {
+    boom := errors.New("boom")
+    lr := newLineReader(io.MultiReader(strings.NewReader("a\nb"), iotest.ErrReader(boom)))
+    lines, _ := scanAll(lr)
+    if !reflect.DeepEqual(lines, []string{"a", "b"}) {
+        t.Errorf("lines = %q, want the lines before the error", lines)
+    }
+    if err := lr.Err(); err != boom {
+        t.Errorf("Err() = %v, want %v", err, boom)
+    }
+}
+
+func TestLineReaderUnread(t *testing.T) {
+    lr := newLineReader(iotest.OneByteReader(strings.NewReader("h\r\na\rb\nc\nd")))
+    lr.Scan() // Header
+
+    // Read ahead two lines and put them back
+    ahead := []queuedLine{}
+    for i := 0; i < 2 && lr.Scan(); i++ {
+        ahead = append(ahead, queuedLine{lr.Text(), lr.Line()})
+    }
+    lr.Unread(ahead)
+    if lr.Line() != 1 {
+        t.Errorf("Line() after Unread = %d, want 1", lr.Line())
+    }
+
+    // The lines come back with their numbers, then reading goes on
+    lines, nums := scanAll(lr)
+    if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(lines, want) {
+        t.Errorf("lines = %q, want %q", lines, want)
+    }
+    if want := []int{2, 3, 4, 5}; !reflect.DeepEqual(nums, want) {
+        t.Errorf("line numbers = %v, want %v", nums, want)
+    }
+}
+
+func TestLineReaderUnreadTwice(t *testing.T) {
+    // A second read-ahead that starts inside the first one's lines
+    lr := newLineReader(strings.NewReader("a\nb\nc\nd\n"))
+    first := []queuedLine{}
+    for i := 0; i < 3 && lr.Scan(); i++ {
+        first = append(first, queuedLine{lr.Text(), lr.Line()})
+    }
+    lr.Unread(first)
+    lr.Scan() // "a"
+
+    second := []queuedLine{}
+    for i := 0; i < 3 && lr.Scan(); i++ {
+        second = append(second, queuedLine{lr.Text(), lr.Line()})
+    }
+    lr.Unread(second)
+
+    lines, nums := scanAll(lr)
+    if want := []string{"b", "c", "d"}; !reflect.DeepEqual(lines, want) {
+        t.Errorf("lines = %q, want %q", lines, want)
+    }
+    if want := []int{2, 3, 4}; !reflect.DeepEqual(nums, want) {
+        t.Errorf("line numbers = %v, want %v", nums, want)
+    }
+}
+
+func TestSplitFields(t *testing.T) {
+    tests := []struct {
+        name  string
+        line  string
+        delim byte
+        want  []string
+        open  bool
+    }{
+        {"plain", "a,b,c", ',', []string{"a", "b", "c"}, false},
+        {"empty fields", ",a,,", ',', []string{"", "a", "", ""}, false},
+        {"empty line", "", ',', []string{""}, false},
+        {"quoted delimiter", `a,"b,c",d`, ',', []string{"a", "b,c", "d"}, false},
+        {"quoted semicolon", `"12,5";"1;2"`, ';', []string{"12,5", "1;2"}, false},
+        {"escaped quote", `"say ""hi""",x`, ',', []string{`say "hi"`, "x"}, false},
+        {"only an escaped quote", `""""`, ',', []string{`"`}, false},
+        {"empty quoted field", `"",a`, ',', []string{"", "a"}, false},
+        {"quote inside unquoted field", `5'7",a"b`, ',', []string{`5'7"`, `a"b`}, false},
+        {"text after closing quote", `"a"b,c`, ',', []string{"ab", "c"}, false},
+        {"other delimiter ignored", "a;b,c", ';', []string{"a", "b,c"}, false},
+        {"unterminated quote", `a,"b,c`, ',', []string{"a", "b,c"}, true},
+        {"line break inside quotes", "a,\"b\nc\",d", ',', []string{"a", "b\nc", "d"}, false},
+        {"ends after escaped quote", `a,"b""`, ',', []string{"a", `b"`}, true},
+    }
+
+    for _, tt := range tests {
+        fields, open := splitFields(tt.line, tt.delim)
+        if !reflect.DeepEqual(fields, tt.want) || open != tt.open {
+            t.Errorf("%s: splitFields(%q) = %q, %v, want %q, %v", tt.name, tt.line, fields, open, tt.want, tt.open)
+        }
+    }
+}
+
+func TestDetectDelimiter(t *testing.T) {
+    tests := []struct {
+        line string
+        want byte
+    }{
+        {"Patient_ID\tScan_Date\tBMD", '\t'},
+        {"Patient_ID,Scan_Date,BMD", ','},
+        {"Patient_ID;Scan_Date;BMD", ';'},
+        {`"ID";"Name, First";"BMD"`, ';'},
+        {"Patient_ID", '\t'},
+    }
+
+    for _, tt := range tests {
+        if got := detectDelimiter(tt.line); got != tt.want {
+            t.Errorf("detectDelimiter(%q) = %q, want %q", tt.line, got, tt.want)
+        }
+    }
+}
+
+func TestTabFieldsMultiline(t *testing.T) {
+    // A quoted field that spans lines, read one byte at a time
+    input := "1,\"first\r\nsecond\rthird\",\"a\tb\"\n2,x\n"
+    rr := &RecordReader{lines: newLineReader(iotest.OneByteReader(strings.NewReader(input))), delim: ','}
+
+    rows, nums := []string{}, []int{}
+    for rr.lines.Scan() {
+        num := rr.lines.Line()
+        rows = append(rows, rr.tabFields(rr.lines.Text()))
+        nums = append(nums, num)
+    }
+    if want := []string{"1\tfirst second third\ta b", "2\tx"}; !reflect.DeepEqual(rows, want) {
+        t.Errorf("rows = %q, want %q", rows, want)
+    }
+    if want := []int{1, 4}; !reflect.DeepEqual(nums, want) {
+        t.Errorf("row line numbers = %v, want %v", nums, want)
+    }
+}
@@ -2,9 +2,12 @@ package main
 
 import (
     "bufio"
+    "errors"
     "fmt"
+    "io"
     "os"
     "path/filepath"
+    "strings"
 
     "github.com/spf13/pflag"
 )
@@ -12,11 +15,39 @@ import (
 func main() {
     var format string
     var output string
+    var encoding string
+    var lenient bool
+    var strict bool
+    var diagnostics string
+    var vendor string
+    var specs string
+    var sheet string
+    var typeName string
+    var dateInput string
+    var dateFormat string
+    var locale string
+    var decimalSeparator string
+    var split bool
+    var perMember bool
     var dryRun bool
     var help bool
 
     pflag.StringVarP(&format, "format", "f", "json", "Output format: json or csv")
-    pflag.StringVarP(&output, "output", "o", "", "Output file path (default: <input>.<format>)")
+    pflag.StringVarP(&output, "output", "o", "", "Output file path, or - for standard output (default: <input>.<format>)")
+    pflag.StringVarP(&encoding, "encoding", "e", "auto", "Input encoding: auto, utf-8, utf-16le, utf-16be or windows-1252")
+    pflag.StringVar(&sheet, "sheet", "", "Worksheet of an XLSX input to read (default: the first)")
+    pflag.BoolVarP(&lenient, "lenient", "l", false, "Skip rows that fail to parse and report them instead of aborting")
+    pflag.BoolVarP(&strict, "strict", "s", false, "Fail on any header/row column mismatch, duplicate header or non-numeric value")
+    pflag.StringVar(&diagnostics, "diagnostics", "", "Diagnostics report path, .json or .csv (default with --lenient: <output>.diagnostics.<format>)")
+    pflag.StringVar(&vendor, "vendor", "auto", "Scanner vendor conventions: auto, ge, hologic or dxafile")
+    pflag.StringVarP(&typeName, "type", "t", "auto", "Report type: auto, bodycomp, totalbody, corescan, spine, femur, forearm or a spec name")
+    pflag.StringVar(&specs, "specs", "", "Directory of JSON or YAML format spec files (default: <config dir>/dxafile/specs)")
+    pflag.StringVar(&dateInput, "date-input", "us", "Scan date order in the input: us, eu, iso or a Go layout")
+    pflag.StringVar(&dateFormat, "date-format", "input", "Scan date format in the output: input, iso, us, eu or a Go layout")
+    pflag.StringVar(&decimalSeparator, "decimal-separator", "auto", "Decimal separator of the numbers: auto, point (.) or comma (,)")
+    pflag.StringVar(&locale, "locale", "", "Locale the export was written in, e.g. de_DE or en_US; sets the decimal separator")
+    pflag.BoolVar(&split, "split", false, "Write each section of a multi-section file to its own output file")
+    pflag.BoolVar(&perMember, "per-member", false, "Write each member of an archive input to its own output file")
     pflag.BoolVarP(&dryRun, "dry-run", "d", false, "Show file type and record count without converting")
     pflag.BoolVarP(&help, "help", "h", false, "Show detailed help information")
     pflag.Parse()
@@ -29,9 +60,9 @@ func main() {
 
     // Validate argument count
     if pflag.NArg() != 1 {
-        fmt.Println("Error: Expected exactly one input file")
-        fmt.Println("Usage: dxafile <file> [options]")
-        fmt.Println("Run 'dxafile --help' for more information")
+        fmt.Fprintln(os.Stderr, "Error: Expected exactly one input file")
+        fmt.Fprintln(os.Stderr, "Usage: dxafile <file> [options]")
+        fmt.Fprintln(os.Stderr, "Run 'dxafile --help' for more information")
         os.Exit(1)
     }
 
@@ -42,72 +73,582 @@ func main() {
     case "json", "csv":
         // Valid format
     default:
-        fmt.Printf("Error: Invalid format '%s'. Use 'json' or 'csv'\n", format)
+        fmt.Fprintf(os.Stderr, "Error: Invalid format '%s'. Use 'json' or 'csv'\n", format)
         os.Exit(1)
     }
 
-    // Auto-name output if not provided
+    // Validate encoding
+    if !validEncoding(encoding) {
+        fmt.Fprintf(os.Stderr, "Error: Invalid encoding '%s'. Use auto, utf-8, utf-16le, utf-16be or windows-1252\n", encoding)
+        os.Exit(1)
+    }
+
+    // Strict and lenient parsing are opposites
+    if strict && lenient {
+        fmt.Fprintln(os.Stderr, "Error: --strict and --lenient cannot be used together")
+        os.Exit(1)
+    }
+
+    // Validate vendor
+    if _, _, err := lookupVendor(vendor); err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+
+    // Load the spec-defined formats; the default directory is optional
+    if specs == "" {
+        specs = defaultSpecDir()
+    } else if info, err := os.Stat(specs); err != nil || !info.IsDir() {
+        fmt.Fprintf(os.Stderr, "Error: Spec directory '%s' not found\n", specs)
+        os.Exit(1)
+    }
+    if specs != "" {
+        if err := LoadSpecs(specs); err != nil {
+            fmt.Fprintln(os.Stderr, "Error loading specs:", err)
+            os.Exit(1)
+        }
+    }
+
+    // Validate the report type; spec names are valid once the specs are loaded
+    if _, err := lookupDXAType(typeName); err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+
+    // Validate date layouts
+    if _, err := resolveDateInput(dateInput); err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+    dateFormat, err := resolveDateFormat(dateFormat)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+
+    // Validate the decimal separator; a locale implies one
+    decimalSeparator, err = resolveDecimalSeparator(locale, decimalSeparator)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+
+    // Auto-name output if not provided; standard input goes to standard output
     if output == "" {
         ext := "." + format
         output = inputFile + ext
+        if inputFile == stdioPath {
+            output = stdioPath
+        }
+    }
+
+    // Standard output holds a single output
+    if output == stdioPath && (split || perMember) {
+        fmt.Fprintln(os.Stderr, "Error: --split and --per-member write several files and can't be used with --output=-")
+        os.Exit(1)
+    }
+    if output == stdioPath && diagnostics == stdioPath {
+        fmt.Fprintln(os.Stderr, "Error: --output and --diagnostics can't both be written to standard output")
+        os.Exit(1)
+    }
+
+    // Lenient runs always produce a diagnostics report next to the output; with
+    // the output on standard output the rows are listed on standard error instead
+    if lenient && diagnostics == "" && output != stdioPath {
+        diagnostics = output + ".diagnostics." + format
+    }
+
+    // Open input file; "-" reads standard input
+    in := os.Stdin
+    if inputFile != stdioPath {
+        in, err = os.Open(inputFile)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Error opening input file:", err)
+            os.Exit(1)
+        }
+        defer in.Close()
     }
+    opts := ParseOptions{Lenient: lenient, Strict: strict, DateInput: dateInput, Vendor: vendor, Type: typeName, DecimalSeparator: decimalSeparator}
 
-    // Open input file
-    in, err := os.Open(inputFile)
+    // Archives are converted member by member; members are held in memory
+    src, ra, size, err := inputSource(in)
     if err != nil {
-        fmt.Println("Error opening input file:", err)
+        fmt.Fprintln(os.Stderr, "Error reading input file:", err)
+        os.Exit(1)
+    }
+    if ra != nil {
+        if kind := archiveKind(ra, size); kind != "" {
+            members, err := readArchive(ra, size, kind, inputFile, encoding, sheet, opts)
+            if err != nil {
+                fmt.Fprintln(os.Stderr, "Error reading input file:", err)
+                os.Exit(1)
+            }
+            run := archiveRun{input: inputFile, kind: kind, format: format, output: output, layout: dateFormat, diagnostics: diagnostics, lenient: lenient, split: split, perMember: perMember}
+            if dryRun {
+                os.Exit(run.analyze(members))
+            }
+            os.Exit(run.convert(members))
+        }
+    }
+    if perMember {
+        fmt.Fprintln(os.Stderr, "Error: --per-member applies to archive inputs only")
         os.Exit(1)
     }
-    defer in.Close()
 
-    // Parse the file
-    dxaType, records, err := ParseFile(in)
+    // Detect (or apply the requested) input encoding and decode to UTF-8; XLSX
+    // workbooks are read from their sheet XML
+    decoded, encodingName, err := readInput(src, encoding, sheet)
     if err != nil {
-        fmt.Println("Error parsing file:", err)
+        fmt.Fprintln(os.Stderr, "Error reading input file:", err)
         os.Exit(1)
     }
 
-    // Get record count
-    recordCount := getRecordCount(records)
+    // Read the header and detect the file type; records are streamed from here on
+    reader, err := NewRecordReader(decoded, opts)
+    if err != nil {
+        // A dry run still shows how the header scored against each format
+        var derr *DetectionError
+        if dryRun && errors.As(err, &derr) {
+            fmt.Println("File Analysis:")
+            fmt.Printf("  Input File:   %s\n", stdioName(inputFile, "standard input"))
+            fmt.Printf("  Encoding:     %s\n", encodingName)
+            fmt.Printf("  Candidates:   %s\n", describeCandidates(derr.Candidates))
+        }
+        fmt.Fprintln(os.Stderr, "Error parsing file:", err)
+        os.Exit(1)
+    }
+    records := &countingIterator{RecordIterator: &dateFormatIterator{RecordIterator: reader, layout: dateFormat}}
 
-    // If dry-run, show info and exit
+    // If dry-run, parse every record to validate the file, show info and exit
     if dryRun {
+        type sectionInfo struct {
+            t          DXAType
+            line       int
+            count      int
+            candidates []TypeCandidate
+        }
+        sections := []sectionInfo{}
+        for {
+            before := records.count
+            for {
+                if _, err := records.Next(); err == io.EOF {
+                    break
+                } else if err != nil {
+                    fmt.Fprintln(os.Stderr, "Error parsing file:", err)
+                    os.Exit(1)
+                }
+            }
+            sections = append(sections, sectionInfo{reader.Type(), reader.SectionLine(), records.count - before, reader.Candidates()})
+
+            more, err := reader.NextSection()
+            if err != nil {
+                fmt.Fprintln(os.Stderr, "Error parsing file:", err)
+                os.Exit(1)
+            }
+            if !more {
+                break
+            }
+        }
+
         fmt.Println("File Analysis:")
-        fmt.Printf("  Input File:   %s\n", inputFile)
-        fmt.Printf("  Format Type:  %s\n", formatTypeName(dxaType))
-        fmt.Printf("  Record Count: %d\n", recordCount)
-        fmt.Printf("  Output Would: %s\n", output)
+        fmt.Printf("  Input File:   %s\n", stdioName(inputFile, "standard input"))
+        fmt.Printf("  Encoding:     %s\n", encodingName)
+        fmt.Printf("  Delimiter:    %s\n", reader.Delimiter())
+        fmt.Printf("  Decimal:      %s\n", reader.DecimalSeparator())
+        fmt.Printf("  Vendor:       %s\n", reader.Vendor())
+        forced := ""
+        if reader.Forced() {
+            forced = " (--type)"
+        }
+        if len(sections) == 1 {
+            fmt.Printf("  Format Type:  %s%s\n", formatTypeName(sections[0].t), forced)
+            fmt.Printf("  Candidates:   %s\n", describeCandidates(sections[0].candidates))
+        } else {
+            fmt.Printf("  Sections:     %d\n", len(sections))
+            for i, s := range sections {
+                fmt.Printf("    %d. line %d: %s%s, %d records\n", i+1, s.line, formatTypeName(s.t), forced, s.count)
+                fmt.Printf("       candidates: %s\n", describeCandidates(s.candidates))
+            }
+        }
+        fmt.Printf("  Record Count: %d\n", records.count)
+        if diags := reader.Diagnostics(); len(diags) > 0 {
+            skipped, repaired := countDiagnostics(diags)
+            fmt.Printf("  Diagnostics:  %d skipped, %d repaired\n", skipped, repaired)
+        }
+        if split {
+            counts := map[DXAType]int{}
+            for _, s := range sections {
+                counts[s.t]++
+                fmt.Printf("  Output Would: %s\n", sectionOutputPath(output, s.t, counts[s.t]))
+            }
+        } else {
+            fmt.Printf("  Output Would: %s\n", stdioName(output, "standard output"))
+        }
         os.Exit(0)
     }
 
-    // Create output file
-    out, err := os.Create(output)
+    // Write output depending on format; records are parsed as they are written
+    outputs := []string{}
+    switch {
+    case split:
+        // One file per section, named after the section type
+        counts := map[DXAType]int{}
+        for {
+            counts[reader.Type()]++
+            path := sectionOutputPath(output, reader.Type(), counts[reader.Type()])
+            err = writeOutputFile(path, func(w io.Writer) error {
+                if format == "csv" {
+                    return OutputCSV(w, records)
+                }
+                return OutputJSON(w, records)
+            })
+            if err != nil {
+                break
+            }
+            outputs = append(outputs, path)
+
+            more, nerr := reader.NextSection()
+            if nerr != nil || !more {
+                err = nerr
+                break
+            }
+        }
+
+    case format == "json":
+        // A single array holding the records of every section
+        outputs = append(outputs, output)
+        err = writeOutputFile(output, func(w io.Writer) error {
+            return OutputJSON(w, &sectionChain{RecordIterator: records, reader: reader})
+        })
+
+    case format == "csv":
+        // One table per section (each with its own header row), separated by a blank line
+        outputs = append(outputs, output)
+        err = writeOutputFile(output, func(w io.Writer) error {
+            for {
+                if err := OutputCSV(w, records); err != nil {
+                    return err
+                }
+                more, err := reader.NextSection()
+                if err != nil || !more {
+                    return err
+                }
+                if _, err := io.WriteString(w, "\n"); err != nil {
+                    return err
+                }
+            }
+        })
+    }
+
     if err != nil {
-        fmt.Println("Error creating output file:", err)
+        if reader.Err() != nil {
+            fmt.Fprintln(os.Stderr, "Error parsing file:", reader.Err())
+        } else {
+            fmt.Fprintln(os.Stderr, "Error writing output:", err)
+        }
         os.Exit(1)
     }
+
+    fmt.Fprintf(os.Stderr, "Successfully converted %d records\n", records.count)
+    for _, path := range outputs {
+        fmt.Fprintf(os.Stderr, "Output file: %s\n", displayPath(path, "standard output"))
+    }
+
+    // Write the diagnostics sidecar if requested
+    if err := reportDiagnostics(diagnostics, lenient, reader.Diagnostics()); err != nil {
+        fmt.Fprintln(os.Stderr, "Error writing diagnostics:", err)
+        os.Exit(1)
+    }
+}
+
+// stdioPath stands for standard input as the input file, and for standard
+// output as the --output or --diagnostics path
+const stdioPath = "-"
+
+// stdioName returns a path as given, or the name of the standard stream when
+// it is "-"
+func stdioName(path, stream string) string {
+    if path == stdioPath {
+        return stream
+    }
+    return path
+}
+
+// displayPath returns a path for messages: absolute, or the name of the
+// standard stream when it is "-"
+func displayPath(path, stream string) string {
+    if path == stdioPath {
+        return stream
+    }
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return path
+    }
+    return abs
+}
+
+// reportDiagnostics writes the diagnostics report to path, if any, and
+// summarizes it on standard error. A lenient run without a report (its output
+// on standard output) lists the rows on standard error instead; other runs
+// give the counts and the first skipped and repaired row (a row too short to
+// hold a record, text in a numeric column, ...), which are reported whatever
+// the mode
+func reportDiagnostics(path string, lenient bool, diags []Diagnostic) error {
+    if path == "" {
+        if lenient {
+            for _, d := range diags {
+                fmt.Fprintf(os.Stderr, "Diagnostic: %s: %s: %s\n", diagnosticPlace(d), d.Action, d.Reason)
+            }
+        } else if skipped, repaired := countDiagnostics(diags); skipped+repaired > 0 {
+            fmt.Fprintf(os.Stderr, "Diagnostics: %d skipped, %d repaired\n", skipped, repaired)
+            for _, action := range []string{ActionSkipped, ActionRepaired} {
+                for _, d := range diags {
+                    if d.Action == action {
+                        fmt.Fprintf(os.Stderr, "Warning: first row %s at %s: %s\n", action, diagnosticPlace(d), d.Reason)
+                        break
+                    }
+                }
+            }
+            fmt.Fprintln(os.Stderr, "Use --diagnostics to list them")
+        }
+        return nil
+    }
+
+    if err := writeDiagnosticsFile(path, diags); err != nil {
+        return err
+    }
+    skipped, repaired := countDiagnostics(diags)
+    fmt.Fprintf(os.Stderr, "Diagnostics: %d skipped, %d repaired\n", skipped, repaired)
+    fmt.Fprintf(os.Stderr, "Diagnostics file: %s\n", displayPath(path, "standard output"))
+    return nil
+}
+
+// diagnosticPlace names the line of a diagnostic, within its archive member if any
+func diagnosticPlace(d Diagnostic) string {
+    where := fmt.Sprintf("line %d", d.Line)
+    if d.File != "" {
+        where = d.File + " " + where
+    }
+    return where
+}
+
+// writeOutputFile creates path and fills it through a buffered writer
+// A partially written file is removed when write fails; "-" writes to standard
+// output
+func writeOutputFile(path string, write func(w io.Writer) error) error {
+    if path == stdioPath {
+        buf := bufio.NewWriter(os.Stdout)
+        if err := write(buf); err != nil {
+            buf.Flush()
+            return err
+        }
+        return buf.Flush()
+    }
+
+    out, err := os.Create(path)
+    if err != nil {
+        return err
+    }
     defer out.Close()
 
     buf := bufio.NewWriter(out)
+    err = write(buf)
+    if err == nil {
+        err = buf.Flush()
+    }
+    if err == nil {
+        err = out.Close()
+    }
+    if err != nil {
+        // Don't leave a partially written file behind
+        out.Close()
+        os.Remove(path)
+    }
+    return err
+}
 
-    // Write output depending on format
-    switch format {
-    case "json":
-        err = OutputJSON(buf, dxaType, records)
-    case "csv":
-        err = OutputCSV(buf, dxaType, records)
+// sectionOutputPath names the output file of one section for --split
+// The section type goes before the extension, numbered from the second section
+// of the same type: data.txt.json -> data.txt.bodycomp.json, data.txt.bodycomp-2.json
+func sectionOutputPath(output string, t DXAType, n int) string {
+    ext := filepath.Ext(output)
+    name := strings.TrimSuffix(output, ext) + "." + dxaTypeKeys[t]
+    if n > 1 {
+        name += fmt.Sprintf("-%d", n)
     }
+    return name + ext
+}
 
-    if err != nil {
-        fmt.Println("Error writing output:", err)
-        os.Exit(1)
+// archiveRun holds the output options of an archive conversion
+type archiveRun struct {
+    input       string // Archive path
+    kind        string // "zip", "gzip" or "tar" (see archiveKind)
+    format      string // "json" or "csv"
+    output      string // Output path; the combined output or the base of per-member outputs
+    layout      string // Output date layout (see resolveDateFormat)
+    diagnostics string // Diagnostics report path, if any
+    lenient     bool   // Rows that fail to parse are skipped
+    split       bool   // One output per record type
+    perMember   bool   // One output per member
+}
+
+// archiveOutput is one output file of an archive conversion and its sections
+type archiveOutput struct {
+    path     string
+    sections []Section
+}
+
+// outputs lists the files an archive conversion writes: one combined output
+// holding a section per record type, or one per member with --per-member;
+// --split then writes each section to its own file
+func (a archiveRun) outputs(members []archiveMember) []archiveOutput {
+    outs := []archiveOutput{}
+    if a.perMember {
+        counts := map[string]int{}
+        for _, m := range members {
+            if m.Err != nil {
+                continue
+            }
+            path := memberOutputPath(a.output, m.Name, 1)
+            counts[path]++
+            path = memberOutputPath(a.output, m.Name, counts[path])
+            outs = append(outs, archiveOutput{path, m.Sections})
+        }
+    } else {
+        outs = append(outs, archiveOutput{a.output, mergeSections(members)})
+    }
+    if !a.split {
+        return outs
     }
 
-    buf.Flush()
+    split := []archiveOutput{}
+    for _, out := range outs {
+        counts := map[DXAType]int{}
+        for _, s := range out.sections {
+            counts[s.Type]++
+            split = append(split, archiveOutput{sectionOutputPath(out.path, s.Type, counts[s.Type]), []Section{s}})
+        }
+    }
+    return split
+}
 
-    absOut, _ := filepath.Abs(output)
-    fmt.Printf("Successfully converted %d records\n", recordCount)
-    fmt.Printf("Output file: %s\n", absOut)
+// analyze prints what --dry-run shows for an archive: every member with its
+// format and record count, or why it failed. Returns the exit status
+func (a archiveRun) analyze(members []archiveMember) int {
+    total, failed := 0, 0
+    diags := []Diagnostic{}
+    fmt.Println("File Analysis:")
+    fmt.Printf("  Input File:   %s\n", stdioName(a.input, "standard input"))
+    fmt.Printf("  Archive:      %s, %d members\n", a.kind, len(members))
+    for i, m := range members {
+        if m.Err != nil {
+            failed++
+            fmt.Printf("    %d. %s: failed: %v\n", i+1, m.Name, m.Err)
+            continue
+        }
+        parts := []string{}
+        for _, s := range m.Sections {
+            n := sectionRecordCount(s)
+            total += n
+            parts = append(parts, fmt.Sprintf("%s, %d records", formatTypeName(s.Type), n))
+        }
+        fmt.Printf("    %d. %s: %s (%s)\n", i+1, m.Name, strings.Join(parts, "; "), m.Encoding)
+        diags = append(diags, m.Diags...)
+    }
+    fmt.Printf("  Record Count: %d\n", total)
+    if len(diags) > 0 {
+        skipped, repaired := countDiagnostics(diags)
+        fmt.Printf("  Diagnostics:  %d skipped, %d repaired\n", skipped, repaired)
+    }
+    if failed > 0 {
+        fmt.Printf("  Failed:       %d of %d members\n", failed, len(members))
+    }
+    for _, out := range a.outputs(members) {
+        fmt.Printf("  Output Would: %s\n", stdioName(out.path, "standard output"))
+    }
+    if failed > 0 {
+        return 1
+    }
+    return 0
+}
+
+// convert writes the outputs of an archive conversion and reports failed
+// members by name. Returns the exit status: 1 when any member failed, even
+// though the others were converted
+func (a archiveRun) convert(members []archiveMember) int {
+    failed := []archiveMember{}
+    diags := []Diagnostic{}
+    for _, m := range members {
+        if m.Err != nil {
+            failed = append(failed, m)
+        }
+        diags = append(diags, m.Diags...)
+    }
+    if len(failed) == len(members) {
+        for _, m := range failed {
+            fmt.Fprintf(os.Stderr, "Failed member %s: %v\n", m.Name, m.Err)
+        }
+        fmt.Fprintln(os.Stderr, "Error: no member of the archive could be converted")
+        return 1
+    }
+
+    total := 0
+    paths := []string{}
+    for _, out := range a.outputs(members) {
+        err := writeOutputFile(out.path, func(w io.Writer) error {
+            return writeSections(w, a.format, out.sections, a.layout)
+        })
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Error writing output:", err)
+            return 1
+        }
+        for _, s := range out.sections {
+            total += sectionRecordCount(s)
+        }
+        paths = append(paths, out.path)
+    }
+
+    fmt.Fprintf(os.Stderr, "Successfully converted %d records from %d of %d members\n", total, len(members)-len(failed), len(members))
+    for _, path := range paths {
+        fmt.Fprintf(os.Stderr, "Output file: %s\n", displayPath(path, "standard output"))
+    }
+    for _, m := range failed {
+        fmt.Fprintf(os.Stderr, "Failed member %s: %v\n", m.Name, m.Err)
+    }
+
+    if err := reportDiagnostics(a.diagnostics, a.lenient, diags); err != nil {
+        fmt.Fprintln(os.Stderr, "Error writing diagnostics:", err)
+        return 1
+    }
+
+    if len(failed) > 0 {
+        return 1
+    }
+    return 0
+}
+
+// writeSections writes sections held in memory as one output, the way a
+// multi-section input is written: a single JSON array, or one CSV table per
+// section separated by a blank line
+func writeSections(w io.Writer, format string, sections []Section, layout string) error {
+    its := []RecordIterator{}
+    for _, s := range sections {
+        its = append(its, &dateFormatIterator{RecordIterator: iterateRecords(s.Type, s.Records), layout: layout})
+    }
+    if format == "json" {
+        return OutputJSON(w, &iteratorChain{its: its})
+    }
+    for i, it := range its {
+        if i > 0 {
+            if _, err := io.WriteString(w, "\n"); err != nil {
+                return err
+            }
+        }
+        if err := OutputCSV(w, it); err != nil {
+            return err
+        }
+    }
+    return nil
 }
 
 // showHelp displays comprehensive usage information
@@ -116,20 +657,72 @@ func showHelp() {
 
 DESCRIPTION:
     Converts DEXA (Dual-Energy X-ray Absorptiometry) scanner export files from 
-    UTF-16 LE BOM format into standard JSON or CSV formats.
+    UTF-16 LE BOM format (or re-saved UTF-8/UTF-16 copies) into standard JSON
+    or CSV formats.
     
-    Automatically detects and handles three DEXA format types:
+    Automatically detects and handles six DEXA format types:
       • Body Composition - Fat mass/percentage by body region
       • Total Body       - Bone mineral density (BMD) measurements  
       • Core Scan        - Visceral adipose tissue (VAT) measurements
+      • AP Spine         - BMD, BMC, area and T/Z-scores for L1-L4
+      • Dual Femur       - Hip BMD by site for the left and right hip and mean
+      • Forearm          - Radius/ulna BMD at the 33%, mid and ultra-distal sites
+
+    Further formats can be described in JSON or YAML spec files (see --specs).
 
 USAGE:
     dxafile <input_file> [options]
+    dxafile - [options]              (read standard input, write standard output)
 
 OPTIONS:
     -f, --format <type>     Output format: json or csv (default: json)
-    -o, --output <path>     Output file path (default: <input>.<format>)
-    -d, --dry-run           Analyze file without converting (shows type & count)
+    -o, --output <path>     Output file path, or - for standard output
+                            (default: <input>.<format>; standard output when
+                            the input is -)
+    -e, --encoding <name>   Input encoding: auto, utf-8, utf-16le, utf-16be,
+                            windows-1252 (default: auto)
+        --sheet <name>      Worksheet of an XLSX workbook to read (default:
+                            the first sheet)
+    -l, --lenient           Skip rows that fail to parse instead of aborting;
+                            problems are reported in a diagnostics file
+    -s, --strict            Fail on the first row whose field count differs from
+                            the header, on text in a numeric column, or on
+                            duplicate header names
+        --diagnostics <path>
+                            Diagnostics report (.json or .csv); defaults to
+                            <output>.diagnostics.<format> with --lenient
+        --vendor <name>     Scanner vendor conventions: auto, ge (GE Lunar
+                            enCORE), hologic (Hologic APEX) or dxafile (this
+                            tool's CSV output) (default: auto)
+    -t, --type <name>       Report type: auto, bodycomp, totalbody, corescan,
+                            spine, femur, forearm or the name of a spec format
+                            (default: auto); required when a header matches
+                            several types
+        --specs <dir>       Directory of JSON or YAML format spec files,
+                            loaded at startup (default: <config dir>/dxafile/
+                            specs, e.g. ~/.config/dxafile/specs, when it exists)
+        --date-input <order>
+                            Scan date order in the input: us (MM/DD/YYYY),
+                            eu (DD/MM/YYYY), iso (YYYY-MM-DD) or a Go layout
+                            such as 2006/01/02 (default: us); ISO dates and
+                            times of day are always accepted
+        --date-format <fmt>
+                            Scan date format in the output: input (as written
+                            in the export), iso, us, eu or a Go layout such as
+                            "02 Jan 2006" (default: input)
+        --decimal-separator <sep>
+                            Decimal separator of the numbers: auto, point (.)
+                            or comma (,) (default: auto, detected from the
+                            data rows)
+        --locale <name>     Locale the export was written in, such as de_DE,
+                            fr_FR or en_US; sets the decimal separator
+        --split             Write each section of a multi-section file to its
+                            own file: <output>.bodycomp.json, ...
+        --per-member        Write each member of an archive input to its own
+                            file: <output>.P001.json, ... (default: one
+                            combined output)
+    -d, --dry-run           Analyze file without converting (shows type, count
+                            and the ranked type candidates)
     -h, --help              Show this help message
 
 EXAMPLES:
@@ -145,6 +738,45 @@ EXAMPLES:
     # Analyze file without converting
     dxafile scan_data.txt --dry-run
 
+    # Convert everything that parses and list the bad rows in a CSV report
+    dxafile scan_data.txt -f csv --lenient --diagnostics=scan_problems.csv
+
+    # Validate a regulated-study export: any irregularity aborts the conversion
+    dxafile study_export.txt --strict
+
+    # Read European dates and write them back the same way
+    dxafile scan_data.txt --date-input=eu --date-format=eu
+
+    # Read a German export whose numbers are all ambiguous ("1,234")
+    dxafile export_de.csv --locale=de_DE
+
+    # Split a batch export holding Body Composition and Core Scan sections
+    dxafile batch_export.txt -f csv --split
+
+    # Convert a Hologic APEX export whose vendor can't be recognized
+    dxafile apex_export.txt --vendor=hologic
+
+    # Force the report type of a header that matches more than one type
+    dxafile combined_export.txt --type=bodycomp
+
+    # Convert a format described by the spec files in ./specs
+    dxafile heel_export.txt --specs=./specs
+
+    # Use in a pipeline: read standard input, write CSV to standard output
+    unzip -p exports.zip P001.txt | dxafile - -f csv | psql -c "\\copy scans FROM STDIN CSV HEADER"
+
+    # Convert a nightly archive of exports, one CSV per patient file
+    dxafile nightly.zip -f csv --per-member
+
+    # Convert the "Results" sheet of an export saved from a spreadsheet
+    dxafile scan_data.xlsx --sheet=Results -f csv
+
+    # Re-convert an earlier JSON output to CSV
+    dxafile scan_data.json -f csv -o scan_data.csv
+
+    # Force the input encoding of a re-saved export
+    dxafile resaved.txt --encoding=utf-8
+
     # Batch convert all .txt files to CSV
     for file in *.txt; do dxafile "$file" -f csv; done
 
@@ -153,28 +785,129 @@ FILE FORMAT DETECTION:
       • Body Composition: Header contains "arms fat mass"
       • Total Body:       Header contains "head bmd"
       • Core Scan:        Header contains "vat mass"
+      • AP Spine:         Header contains a vertebra BMD column ("L1 BMD",
+                          "L1-L4 BMD", ...)
+      • Dual Femur:       Header contains a femoral neck BMD column ("Left
+                          Neck BMD", "Neck Mean BMD", ...)
+      • Forearm:          Header contains a radius or ulna BMD column
+                          ("Radius 33% BMD", "Ulna UD BMD", ...)
+      • Spec formats:     All "detect" patterns of a spec file match the
+                          header (checked after the built-in types)
+
+    The scanner vendor is identified from a banner line above the header
+    ("Hologic APEX 5.6.0.5", "GE Healthcare enCORE 16") or from its column
+    names. Hologic APEX codes such as L_ARM_FAT, NECK_BMD or VFAT_MASS are
+    translated to the names above, with Hologic's default units (g, g/cm²,
+    cm², cm³), and ID/date columns are found by name wherever they appear.
+
+    Every type is also scored against the whole header: half for its
+    distinctive column, half for the share of columns it can read. --dry-run
+    lists the ranked candidates ("bodycomp 98%, corescan 51%"). A header with
+    the distinctive columns of several types is an error unless --type names
+    the type to use; --type applies to every section of the file.
+
+    A header line further down the file starts a new section, which may be of a
+    different type. By default all sections go to one output: a single JSON
+    array whose records start with their "type" and "section", or one CSV
+    table per section separated by a blank line. --split writes each section
+    to its own file instead
 
 INPUT FORMAT:
-    • Encoding: UTF-16 Little Endian with BOM
-    • Structure: Tab-delimited text
+    • Encoding: UTF-16 Little Endian with BOM (scanner default)
+                Auto-detected: UTF-8 (with or without BOM), UTF-16 LE/BE
+                (with or without BOM), Windows-1252
+    • Structure: Tab-delimited text; lines may end in LF, CRLF or CR and
+                 may be of any length. Copies re-saved from a spreadsheet
+                 as comma- or semicolon-delimited CSV (with RFC 4180
+                 quoting) are detected from the header row and read the
+                 same way
+    • XLSX workbooks: the first sheet, or the one named by --sheet, is read
+             like a tab-delimited export; cells formatted as dates are read
+             as ISO dates. No office software is needed
+    • Archives: a .zip, .gz, .tar or .tar.gz input is read member by member,
+             each member like a single input (text export or XLSX). By
+             default the records of all members go to one output, one CSV
+             table per record type; --per-member writes one output per
+             member. Members that fail are listed by name and the exit
+             status is 1, but the other members are still converted
+    • This tool's own outputs: a CSV output (recognized by its Measure_Date
+             column) or JSON output is read back like the export it was
+             converted from, so old conversions can be re-converted or
+             merged without the original exports
     • Common ID fields: ID1, ID2, ID3, Date
+    • Demographics: Age, Sex, Height, Weight, Ethnicity and Birth Date
+             columns are recognized by name and written after the ID fields
+    • Dates: MM/DD/YYYY by default, optionally with a time of day; rows with
+             a date that doesn't match --date-input are reported as errors
+    • Numbers: decimal points (1,234.5) or decimal commas (1.234,5), detected
+             from the first data rows or set by --decimal-separator or
+             --locale. Without a number that settles it ("12,5", "0,123",
+             "1,234.5"), a semicolon-delimited file is read with decimal
+             commas and any other with decimal points, and each number that
+             reads either way ("1,234") is reported as a repaired row.
+             Numbers that don't fit the separator are reported and left out.
+             XLSX numbers always have a decimal point and are read as stored
     • Data fields: Vary by DEXA format type
 
 OUTPUT FORMATS:
     JSON: Pretty-printed with 2-space indentation
     CSV:  Headers included, format-specific column layout
+    Dates are written as the export wrote them (11/11/2025) unless
+    --date-format is given; --date-format=iso writes YYYY-MM-DD, or
+    YYYY-MM-DDThh:mm:ss when the export has a time of day
 
 NOTES:
     • Input files are not modified (read-only)
     • Output files are overwritten if they already exist
+    • "-" as the input reads standard input; as --output or --diagnostics it
+      writes standard output. Status and error messages always go to
+      standard error, so piped data stays clean; --dry-run prints its
+      analysis on standard output. With --lenient and the output on standard
+      output, skipped rows are listed on standard error unless --diagnostics
+      names a report file. --split and --per-member can't write to -
     • Empty lines in input are automatically skipped
     • Malformed lines generate descriptive error messages
+      (with --lenient they are skipped and listed in the diagnostics file)
+    • Rows kept after working around a problem (text such as "pending" in
+      a numeric column, which becomes null, or a row shorter than the
+      header) are always reported as repaired, and rows too short to hold a
+      record as skipped: standard error counts both, and --diagnostics
+      lists them
 
 For more information, visit: https://github.com/derickschaefer/dxafile`)
 }
 
+// describeCandidates lists scored formats for display, best first:
+// "bodycomp 98%, corescan 51%"
+func describeCandidates(candidates []TypeCandidate) string {
+    if len(candidates) == 0 {
+        return "none"
+    }
+    names := []string{}
+    for _, c := range candidates {
+        names = append(names, c.String())
+    }
+    return strings.Join(names, ", ")
+}
+
+// defaultSpecDir returns <config dir>/dxafile/specs when it exists, or ""
+func defaultSpecDir() string {
+    config, err := os.UserConfigDir()
+    if err != nil {
+        return ""
+    }
+    dir := filepath.Join(config, "dxafile", "specs")
+    if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+        return ""
+    }
+    return dir
+}
+
 // formatTypeName returns a human-readable name for the DXA type
 func formatTypeName(t DXAType) string {
+    if spec := specFor(t); spec != nil {
+        return spec.Title
+    }
     switch t {
     case DXATypeBodyComp:
         return "Body Composition (Fat Mass/Percentage)"
@@ -182,21 +915,13 @@ func formatTypeName(t DXAType) string {
         return "Total Body (BMD Measurements)"
     case DXATypeCoreScan:
         return "Core Scan (VAT Measurements)"
+    case DXATypeSpine:
+        return "AP Spine (L1-L4 BMD Measurements)"
+    case DXATypeFemur:
+        return "Dual Femur (Hip BMD Measurements)"
+    case DXATypeForearm:
+        return "Forearm (Radius/Ulna BMD Measurements)"
     default:
         return "Unknown"
     }
 }
-
-// getRecordCount returns the number of records in the parsed data
-func getRecordCount(records interface{}) int {
-    switch r := records.(type) {
-    case []BodyFatRecord:
-        return len(r)
-    case []TotalBodyRecord:
-        return len(r)
-    case []CoreScanRecord:
-        return len(r)
-    default:
-        return 0
-    }
-}
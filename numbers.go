@@ -0,0 +1,290 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Exports from European installations write decimal commas ("12,5"), often in
+// semicolon-delimited copies, where others write decimal points with optional
+// comma thousands separators ("1,234.5"). The decimal separator is given by
+// --decimal-separator or --locale, or detected from the first data rows. Before
+// a row is parsed its numbers are rewritten with a decimal point and without
+// thousands separators (see normalizeNumbers), so parseNumber only ever sees
+// one notation
+
+// decimalSampleLines is the number of lines read ahead of the data rows to
+// detect the decimal separator
+const decimalSampleLines = 100
+
+// decimalNames are the display names of the decimal separators
+var decimalNames = map[byte]string{'.': "point", ',': "comma"}
+
+// decimalSeparatorNames maps --decimal-separator values to separators
+var decimalSeparatorNames = map[string]byte{
+    ".": '.', "point": '.', "dot": '.', "period": '.',
+    ",": ',', "comma": ',',
+}
+
+// decimalCommaLanguages are the languages whose locales write a decimal comma
+var decimalCommaLanguages = map[string]bool{
+    "bg": true, "ca": true, "cs": true, "da": true, "de": true, "el": true, "es": true,
+    "et": true, "eu": true, "fi": true, "fr": true, "gl": true, "hr": true, "hu": true,
+    "id": true, "is": true, "it": true, "lt": true, "lv": true, "nb": true, "nl": true,
+    "nn": true, "no": true, "pl": true, "pt": true, "ro": true, "ru": true, "sk": true,
+    "sl": true, "sr": true, "sv": true, "tr": true, "uk": true, "vi": true,
+}
+
+// decimalLocales are the locales that differ from their language's separator
+var decimalLocales = map[string]byte{
+    "de_ch": '.', "de_li": '.', "it_ch": '.', "es_mx": '.', "es_us": '.', "es_pr": '.',
+    "en_za": ',',
+}
+
+// localeRE matches a normalized locale name: a language, optionally a region
+var localeRE = regexp.MustCompile(`^[a-z]{2,3}(_[a-z]{2}|_[0-9]{3})?$`)
+
+// localeDecimalSeparator returns the decimal separator written in a locale
+// such as "de_DE", "de-AT", "fr" or "en_US.UTF-8"; "C" and "POSIX" use a point
+func localeDecimalSeparator(locale string) (byte, error) {
+    l := strings.ToLower(strings.TrimSpace(locale))
+    if i := strings.IndexAny(l, ".@"); i >= 0 {
+        l = l[:i] // Encoding or modifier
+    }
+    l = strings.ReplaceAll(l, "-", "_")
+    if l == "c" || l == "posix" {
+        return '.', nil
+    }
+    if !localeRE.MatchString(l) {
+        return 0, fmt.Errorf("invalid locale %q: use a language and region such as de_DE, fr_FR or en_US", locale)
+    }
+    if sep, ok := decimalLocales[l]; ok {
+        return sep, nil
+    }
+    if decimalCommaLanguages[strings.SplitN(l, "_", 2)[0]] {
+        return ',', nil
+    }
+    return '.', nil
+}
+
+// resolveDecimalSeparator combines --locale and --decimal-separator into the
+// value of ParseOptions.DecimalSeparator: ".", "," or "" to detect it
+func resolveDecimalSeparator(locale, separator string) (string, error) {
+    sep := byte(0)
+    s := strings.ToLower(strings.TrimSpace(separator))
+    if s != "" && s != "auto" {
+        var ok bool
+        if sep, ok = decimalSeparatorNames[s]; !ok {
+            return "", fmt.Errorf("invalid decimal separator %q: use auto, point (.) or comma (,)", separator)
+        }
+    }
+    if strings.TrimSpace(locale) != "" {
+        l, err := localeDecimalSeparator(locale)
+        if err != nil {
+            return "", err
+        }
+        if sep != 0 && sep != l {
+            return "", fmt.Errorf("locale %s writes a decimal %s, but the decimal separator is %s", locale, decimalNames[l], decimalNames[sep])
+        }
+        sep = l
+    }
+    if sep == 0 {
+        return "", nil
+    }
+    return string(sep), nil
+}
+
+// numberTokenRE matches a number in either notation: "12,5", "1.234,5", "1,234.5"
+var numberTokenRE = regexp.MustCompile(`[-+]?\d(?:[\d.,]*\d)?`)
+
+// numberLoc returns the position of the number of a cell that holds one, with
+// an optional unit after it ("12,5", "-1.2 SD", "70 kg"), or nil. Cells with
+// text before the number, such as "iDXA 2.1.3", are left alone
+func numberLoc(cell string) []int {
+    loc := numberTokenRE.FindStringIndex(cell)
+    if loc == nil || strings.TrimSpace(cell[:loc[0]]) != "" {
+        return nil
+    }
+    return loc
+}
+
+// decimalEvidence returns the decimal separator a number proves, or 0 when it
+// has no separator or reads as a number either way ("1,234", "12.500")
+func decimalEvidence(tok string) byte {
+    digits := strings.TrimLeft(tok, "+-")
+    dots, commas := strings.Count(digits, "."), strings.Count(digits, ",")
+    switch {
+    case dots == 0 && commas == 0:
+        return 0
+    case dots > 0 && commas > 0:
+        // The last separator is the decimal one: "1,234.5", "1.234,5"
+        if strings.LastIndex(digits, ".") > strings.LastIndex(digits, ",") {
+            return '.'
+        }
+        return ','
+    case dots > 1:
+        return ',' // "1.234.567": dots group thousands
+    case commas > 1:
+        return '.'
+    }
+
+    // A single separator is the decimal one unless it could group thousands
+    sep := byte('.')
+    if commas == 1 {
+        sep = ','
+    }
+    if couldGroupThousands(digits, sep) {
+        return 0
+    }
+    return sep
+}
+
+// couldGroupThousands reports whether the single separator of a number could
+// also be a thousands separator: 1 to 3 leading digits, not starting with 0,
+// and exactly 3 digits after it ("1,234", "12.500")
+func couldGroupThousands(digits string, sep byte) bool {
+    i := strings.IndexByte(digits, sep)
+    return i >= 1 && i <= 3 && digits[0] != '0' && len(digits)-i-1 == 3
+}
+
+// canonicalNumber rewrites a number written with the decimal separator sep
+// with a decimal point and no thousands separators: "1.234,5" -> "1234.5" for
+// ','. Returns false when the number doesn't fit sep: the other separator in
+// the decimals ("12,5" for '.') or thousands groups that aren't 3 digits or
+// follow a leading 0 ("0,123" for '.')
+func canonicalNumber(tok string, sep byte) (string, bool) {
+    thousands := byte(',')
+    if sep == ',' {
+        thousands = '.'
+    }
+    sign := ""
+    if tok != "" && (tok[0] == '-' || tok[0] == '+') {
+        sign, tok = tok[:1], tok[1:]
+    }
+
+    whole, frac := tok, ""
+    if i := strings.IndexByte(tok, sep); i >= 0 {
+        whole, frac = tok[:i], tok[i+1:]
+        if strings.IndexByte(frac, sep) >= 0 || strings.IndexByte(frac, thousands) >= 0 {
+            return "", false
+        }
+    }
+    if strings.IndexByte(whole, thousands) >= 0 {
+        groups := strings.Split(whole, string(thousands))
+        if len(groups[0]) == 0 || len(groups[0]) > 3 || groups[0][0] == '0' {
+            return "", false
+        }
+        for _, g := range groups[1:] {
+            if len(g) != 3 {
+                return "", false
+            }
+        }
+        whole = strings.Join(groups, "")
+    }
+    if frac == "" {
+        return sign + whole, true
+    }
+    return sign + whole + "." + frac, true
+}
+
+// textKeys are the columns past the ID fields that hold text, not numbers
+var textKeys = map[string]bool{"Sex": true, "Ethnicity": true, "Birth_Date": true, "TBW_Device": true}
+
+// isNumericColumn reports whether the cells of a column hold measurements
+func isNumericColumn(col Column) bool {
+    return col.Index >= 4 && col.Key != "" && !textKeys[col.Key]
+}
+
+// detectDecimal decides the decimal separator from the numbers of the lines
+// ahead of the reader, which are read and then put back. The separator most
+// numbers prove wins; without any proof the header decides: a comma after a
+// semicolon-delimited header, a point otherwise, and numbers that read either
+// way are then reported as ambiguous (see normalizeNumbers)
+func (rr *RecordReader) detectDecimal() {
+    sample := []queuedLine{}
+    votes := map[byte]int{}
+    for len(sample) < decimalSampleLines && rr.lines.Scan() {
+        line := queuedLine{rr.lines.Text(), rr.lines.Line()}
+        sample = append(sample, line)
+
+        fields, _ := splitFields(line.text, rr.delim)
+        if rr.order != nil {
+            fields = reorderFields(fields, rr.order)
+        }
+        for _, col := range rr.cols {
+            if col.Index >= len(fields) || !isNumericColumn(col) {
+                continue
+            }
+            if loc := numberLoc(fields[col.Index]); loc != nil {
+                if sep := decimalEvidence(fields[col.Index][loc[0]:loc[1]]); sep != 0 {
+                    votes[sep]++
+                }
+            }
+        }
+    }
+    rr.lines.Unread(sample)
+
+    hint := byte('.')
+    if rr.delim == ';' {
+        hint = ','
+    }
+    switch {
+    case votes['.'] == 0 && votes[','] == 0:
+        rr.decimal, rr.decided = hint, "assumed"
+    case votes['.'] > votes[',']:
+        rr.decimal, rr.decided = '.', "detected"
+    case votes[','] > votes['.']:
+        rr.decimal, rr.decided = ',', "detected"
+    default:
+        rr.decimal, rr.decided = hint, "detected"
+    }
+}
+
+// normalizeNumbers rewrites the numbers in the measurement cells of a row (in
+// header order) with a decimal point and without thousands separators, as
+// parseNumber reads them
+// A number that doesn't fit the decimal separator is reported through onIssue
+// and left out. While the separator is only assumed, a number that reads
+// either way is reported too and read with the assumed one; a number that fits
+// it and proves it confirms the separator
+func (rr *RecordReader) normalizeNumbers(line string, onIssue func(string) error) (string, error) {
+    fields := strings.Split(line, "\t")
+    for _, col := range rr.cols {
+        if col.Index >= len(fields) || !isNumericColumn(col) {
+            continue
+        }
+        cell := fields[col.Index]
+        loc := numberLoc(cell)
+        if loc == nil {
+            continue // Blank, a placeholder or text: left to cellNumber
+        }
+        tok := cell[loc[0]:loc[1]]
+
+        num, ok := canonicalNumber(tok, rr.decimal)
+        if !ok {
+            reason := fmt.Sprintf("column %d %q: number %q doesn't use a decimal %s; use --decimal-separator or --locale to change it", col.Index+1, col.Name, tok, decimalNames[rr.decimal])
+            if err := onIssue(reason); err != nil {
+                return "", err
+            }
+            fields[col.Index] = ""
+            continue
+        }
+
+        if rr.decided == "assumed" {
+            switch decimalEvidence(tok) {
+            case rr.decimal:
+                rr.decided = "detected"
+            case 0:
+                if strings.ContainsAny(tok, ".,") {
+                    reason := fmt.Sprintf("column %d %q: ambiguous number %q read as %s (decimal %s assumed); use --decimal-separator or --locale to choose", col.Index+1, col.Name, tok, num, decimalNames[rr.decimal])
+                    if err := onIssue(reason); err != nil {
+                        return "", err
+                    }
+                }
+            }
+        }
+        fields[col.Index] = cell[:loc[0]] + num + cell[loc[1]:]
+    }
+    return strings.Join(fields, "\t"), nil
+}
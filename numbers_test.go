@@ -0,0 +1,257 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestDecimalEvidence(t *testing.T) {
+    tests := []struct {
+        tok  string
+        want byte
+    }{
+        {"12", 0},
+        {"1,234", 0},      // Thousands or decimals
+        {"12.500", 0},     // Thousands or decimals
+        {"1.234,5", ','},  // The last separator is the decimal one
+        {"1,234.5", '.'},  // The last separator is the decimal one
+        {"0,123", ','},    // A leading 0 doesn't group thousands
+        {"-0.123", '.'},   // Sign ignored
+        {"12,5", ','},     // Not 3 decimals
+        {"1234.567", '.'}, // 4 leading digits
+        {"1.234.567", ','},
+        {"1,234,567", '.'},
+    }
+
+    for _, tt := range tests {
+        if got := decimalEvidence(tt.tok); got != tt.want {
+            t.Errorf("decimalEvidence(%q) = %q, want %q", tt.tok, got, tt.want)
+        }
+    }
+}
+
+func TestCanonicalNumber(t *testing.T) {
+    tests := []struct {
+        tok   string
+        point string // Read with a decimal point, "" when it doesn't fit
+        comma string // Read with a decimal comma, "" when it doesn't fit
+    }{
+        {"12", "12", "12"},
+        {"1,234", "1234", "1.234"},
+        {"1.234,5", "", "1234.5"},
+        {"1,234.5", "1234.5", ""},
+        {"0,123", "", "0.123"},
+        {"12.500", "12.500", "12500"},
+        {"12,5", "", "12.5"},
+        {"12.5", "12.5", ""},
+        {"1,234,567.8", "1234567.8", ""},
+        {"1.234.567,8", "", "1234567.8"},
+        {"-1.234,5", "", "-1234.5"},
+        {"+1,234.5", "+1234.5", ""},
+        {"1234,567.8", "", ""}, // Thousands group of 4 digits
+        {"1,23.4", "", ""},
+    }
+
+    for _, tt := range tests {
+        for _, c := range []struct {
+            sep  byte
+            want string
+        }{{'.', tt.point}, {',', tt.comma}} {
+            got, ok := canonicalNumber(tt.tok, c.sep)
+            if ok != (c.want != "") || got != c.want {
+                t.Errorf("canonicalNumber(%q, %q) = %q, %v, want %q", tt.tok, c.sep, got, ok, c.want)
+            }
+        }
+    }
+}
+
+func TestResolveDecimalSeparator(t *testing.T) {
+    tests := []struct {
+        locale    string
+        separator string
+        want      string
+        err       string // Start of the error, "" for none
+    }{
+        {"", "", "", ""},
+        {"", "auto", "", ""},
+        {"", ".", ".", ""},
+        {"", "Point", ".", ""},
+        {"", ",", ",", ""},
+        {"", "comma", ",", ""},
+        {"", ";", "", `invalid decimal separator ";"`},
+        {"de_DE", "", ",", ""},
+        {"de-AT", "auto", ",", ""},
+        {"fr", "", ",", ""},
+        {"de_CH", "", ".", ""},
+        {"en_ZA", "", ",", ""},
+        {"en_US.UTF-8", "", ".", ""},
+        {"pt_BR@latin", "", ",", ""},
+        {"C", "", ".", ""},
+        {"POSIX", "", ".", ""},
+        {"de_DE", ",", ",", ""},
+        {"en_US", ".", ".", ""},
+        {"de_DE", ".", "", "locale de_DE writes a decimal comma, but the decimal separator is point"},
+        {"en_US", "comma", "", "locale en_US writes a decimal point, but the decimal separator is comma"},
+        {"German", "", "", `invalid locale "German"`},
+        {"de_DE", "x", "", `invalid decimal separator "x"`},
+    }
+
+    for _, tt := range tests {
+        got, err := resolveDecimalSeparator(tt.locale, tt.separator)
+        switch {
+        case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+            t.Errorf("resolveDecimalSeparator(%q, %q) error = %v, want %q", tt.locale, tt.separator, err, tt.err)
+        case tt.err == "" && (err != nil || got != tt.want):
+            t.Errorf("resolveDecimalSeparator(%q, %q) = %q, %v, want %q", tt.locale, tt.separator, got, err, tt.want)
+        }
+    }
+}
+
+// vatExport returns a core scan export with one row for each VAT mass cell
+func vatExport(delim string, masses []string) string {
+    var b strings.Builder
+    header := []string{"Last Name", "First Name", "Patient ID", "Measure Date", "VAT Mass (lbs)", "VAT Volume (in3)"}
+    b.WriteString(strings.Join(header, delim) + "\n")
+    for i, m := range masses {
+        if strings.Contains(m, delim) {
+            m = `"` + m + `"`
+        }
+        b.WriteString(strings.Join([]string{"Doe", "J", fmt.Sprintf("P%d", i+1), "03/14/2025", m, "2"}, delim) + "\n")
+    }
+    return b.String()
+}
+
+// repeat returns n copies of s
+func repeat(s string, n int) []string {
+    out := make([]string, n)
+    for i := range out {
+        out[i] = s
+    }
+    return out
+}
+
+// repeatFloat returns n copies of v
+func repeatFloat(v float64, n int) []float64 {
+    out := make([]float64, n)
+    for i := range out {
+        out[i] = v
+    }
+    return out
+}
+
+func TestDecimalDetection(t *testing.T) {
+    tests := []struct {
+        name      string
+        delim     string
+        separator string
+        masses    []string
+        want      []float64 // VAT mass of each record, -1 for none
+        decimal   string
+        ambiguous int // Rows reported as ambiguous
+        other     int // Rows reported for another reason
+    }{
+        {
+            name:    "proof in the sample",
+            delim:   ",",
+            masses:  []string{"1,234", "12,5", "1,234"},
+            want:    []float64{1.234, 12.5, 1.234},
+            decimal: "comma (detected)",
+        },
+        {
+            name:      "ambiguous past the sample",
+            delim:     ",",
+            masses:    repeat("1,234", decimalSampleLines+20),
+            want:      repeatFloat(1234, decimalSampleLines+20),
+            decimal:   "point (assumed)",
+            ambiguous: decimalSampleLines + 20,
+        },
+        {
+            name:      "semicolon export, ambiguous past the sample",
+            delim:     ";",
+            masses:    repeat("12.500", decimalSampleLines+1),
+            want:      repeatFloat(12500, decimalSampleLines+1),
+            decimal:   "comma (assumed)",
+            ambiguous: decimalSampleLines + 1,
+        },
+        {
+            name:      "proof after the sample",
+            delim:     ",",
+            masses:    append(append(repeat("1,234", decimalSampleLines), "2.5"), "1,234"),
+            want:      append(repeatFloat(1234, decimalSampleLines), 2.5, 1234),
+            decimal:   "point (detected)",
+            ambiguous: decimalSampleLines,
+        },
+        {
+            name:      "contradiction after the sample",
+            delim:     ",",
+            masses:    append(repeat("1,234", decimalSampleLines), "0,5"),
+            want:      append(repeatFloat(1234, decimalSampleLines), -1),
+            decimal:   "point (assumed)",
+            ambiguous: decimalSampleLines,
+            other:     1,
+        },
+        {
+            name:      "separator given",
+            delim:     ";",
+            separator: ".",
+            masses:    []string{"12.500", "1,234.5"},
+            want:      []float64{12.5, 1234.5},
+            decimal:   "point (--decimal-separator)",
+        },
+    }
+
+    for _, tt := range tests {
+        rr, err := NewRecordReader(strings.NewReader(vatExport(tt.delim, tt.masses)), ParseOptions{DecimalSeparator: tt.separator})
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        got := []float64{}
+        for {
+            rec, err := rr.Next()
+            if err == io.EOF {
+                break
+            } else if err != nil {
+                t.Fatalf("%s: %v", tt.name, err)
+            }
+            mass := -1.0
+            if m := rec.(CoreScanRecord).VATMass; m != nil {
+                mass = *m
+            }
+            got = append(got, mass)
+        }
+        if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+            t.Errorf("%s: VAT masses = %v, want %v", tt.name, got, tt.want)
+        }
+        if d := rr.DecimalSeparator(); d != tt.decimal {
+            t.Errorf("%s: DecimalSeparator() = %q, want %q", tt.name, d, tt.decimal)
+        }
+
+        ambiguous, other := 0, 0
+        for _, d := range rr.Diagnostics() {
+            if d.Action != ActionRepaired {
+                t.Errorf("%s: line %d %s, want %s", tt.name, d.Line, d.Action, ActionRepaired)
+            }
+            if strings.Contains(d.Reason, "ambiguous number") {
+                ambiguous++
+            } else {
+                other++
+            }
+        }
+        if ambiguous != tt.ambiguous || other != tt.other {
+            t.Errorf("%s: %d ambiguous and %d other diagnostics, want %d and %d", tt.name, ambiguous, other, tt.ambiguous, tt.other)
+        }
+    }
+}
+
+func TestDecimalDetectionStrict(t *testing.T) {
+    input := vatExport(",", repeat("1,234", decimalSampleLines+1))
+    rr, err := NewRecordReader(strings.NewReader(input), ParseOptions{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := rr.Next(); err == nil || !strings.Contains(err.Error(), "ambiguous number") {
+        t.Errorf("Next() error = %v, want an ambiguous number", err)
+    }
+}
@@ -10,24 +10,64 @@ import (
 
 //
 // JSON OUTPUT — Works for all DXA types
+// Records are written one at a time as elements of a pretty-printed array
 //
-func OutputJSON(w io.Writer, t DXAType, records interface{}) error {
-    enc := json.NewEncoder(w)
-    enc.SetIndent("", "  ")
-    return enc.Encode(records)
+func OutputJSON(w io.Writer, records RecordIterator) error {
+    n := 0
+    for {
+        rec, err := records.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+
+        // Indent each element as if the whole array had been encoded at once
+        data, err := json.MarshalIndent(rec, "  ", "  ")
+        if err != nil {
+            return err
+        }
+
+        sep := "[\n  "
+        if n > 0 {
+            sep = ",\n  "
+        }
+        if _, err := io.WriteString(w, sep); err != nil {
+            return err
+        }
+        if _, err := w.Write(data); err != nil {
+            return err
+        }
+        n++
+    }
+
+    // Close the array (an empty input still produces valid JSON)
+    end := "\n]\n"
+    if n == 0 {
+        end = "[]\n"
+    }
+    _, err := io.WriteString(w, end)
+    return err
 }
 
 //
 // CSV OUTPUT — Dispatch to specific CSV writers by file type
 //
-func OutputCSV(w io.Writer, t DXAType, records interface{}) error {
-    switch t {
+func OutputCSV(w io.Writer, records RecordIterator) error {
+    switch records.Type() {
     case DXATypeBodyComp:
-        return writeCSVBodyComp(w, records.([]BodyFatRecord))
-    case DXATypeTotalBody:
-        return writeCSVTotalBody(w, records.([]TotalBodyRecord))
+        return writeCSVBodyComp(w, records)
+    case DXATypeTotalBody, DXATypeSpine, DXATypeForearm:
+        return writeCSVKeyedValues(w, records)
     case DXATypeCoreScan:
-        return writeCSVCoreScan(w, records.([]CoreScanRecord))
+        return writeCSVCoreScan(w, records)
+    case DXATypeFemur:
+        return writeCSVFemur(w, records)
+    default:
+        if specFor(records.Type()) != nil {
+            return writeCSVKeyedValues(w, records)
+        }
     }
     return fmt.Errorf("unknown file type")
 }
@@ -36,363 +76,638 @@ func OutputCSV(w io.Writer, t DXAType, records interface{}) error {
 // ------------------------------
 // CSV Writers for Each Format
 // ------------------------------
+// Column names come from the iterator's header layout, so the header row can be
+// written before the rest of the records are streamed one at a time. The first
+// record is read ahead so units written in its cells can label the columns
 //
 
 // BODY COMP — Body Composition with friendly column names
-func writeCSVBodyComp(w io.Writer, rows []BodyFatRecord) error {
+// Column names come from each measurement's region and metric as read from the
+// source header, e.g. "Arms" + "Fat Mass" -> Arms_Fat_Mass_Total_lbs, Arms_Fat_Mass_Left_lbs, ...
+func writeCSVBodyComp(w io.Writer, records RecordIterator) error {
     writer := csv.NewWriter(w)
 
-    // Define mass measurement labels in the order they appear
-    massLabels := []string{
-        "Arms_Bone_Mass",
-        "Legs_Bone_Mass",
-        "Trunk_Bone_Mass",
-        "Android_Bone_Mass",
-        "Gynoid_Bone_Mass",
-        "Total_Bone_Mass",
-        "TBLH_Bone_Mass",
-        "Arms_Fat_Mass",
-        "Legs_Fat_Mass",
-        "Trunk_Fat_Mass",
-        "Android_Fat_Mass",
-        "Gynoid_Fat_Mass",
-        "Total_Fat_Mass",
-        "TBLH_Fat_Mass",
-        "Arms_Lean_Mass",
-        "Legs_Lean_Mass",
-        "Trunk_Lean_Mass",
-        "Android_Lean_Mass",
-        "Gynoid_Lean_Mass",
-        "Total_Lean_Mass",
-        "TBLH_Lean_Mass",
-        "Arms_Tissue_Mass",
-        "Legs_Tissue_Mass",
-        "Trunk_Tissue_Mass",
-        "Android_Tissue_Mass",
-        "Gynoid_Tissue_Mass",
-        "Total_Tissue_Mass",
-        "TBLH_Tissue_Mass",
-        "Arms_Fat_Free_Mass",
-        "Legs_Fat_Free_Mass",
-        "Trunk_Fat_Free_Mass",
-        "Android_Fat_Free_Mass",
-        "Gynoid_Fat_Free_Mass",
-        "Total_Fat_Free_Mass",
-        "TBLH_Fat_Free_Mass",
-        "Arms_Total_Mass",
-        "Legs_Total_Mass",
-        "Trunk_Total_Mass",
-        "Android_Total_Mass",
-        "Gynoid_Total_Mass",
-        "Total_Total_Mass",
-        "TBLH_Total_Mass",
-    }
-
-    // Define percentage measurement labels in the order they appear
-    percentLabels := []string{
-        "Arms_Region_Percent_Fat",
-        "Legs_Region_Percent_Fat",
-        "Trunk_Region_Percent_Fat",
-        "Android_Region_Percent_Fat",
-        "Gynoid_Region_Percent_Fat",
-        "Total_Region_Percent_Fat",
-        "TBLH_Region_Percent_Fat",
-        "Arms_Tissue_Percent_Fat",
-        "Legs_Tissue_Percent_Fat",
-        "Trunk_Tissue_Percent_Fat",
-        "Android_Tissue_Percent_Fat",
-        "Gynoid_Tissue_Percent_Fat",
-        "Total_Tissue_Percent_Fat",
-        "TBLH_Tissue_Percent_Fat",
-    }
-
-    // Start with base identifier columns
-    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    first, err := firstRecord(records)
+    if err != nil {
+        return err
+    }
 
-    // Calculate the maximum number of measurement blocks across all records
-    maxMass := 0
-    maxPct := 0
-    for _, r := range rows {
-        if len(r.Mass) > maxMass {
-            maxMass = len(r.Mass)
+    // Units of the first record's blocks, which may come from its cells
+    units := map[string]string{}
+    if r, ok := first.(BodyFatRecord); ok {
+        for _, m := range append(r.Mass, r.Percent...) {
+            units[measurementLabel(m)] = m.Unit
         }
-        if len(r.Percent) > maxPct {
-            maxPct = len(r.Percent)
+        if h := r.Hydration; h != nil {
+            units["TBW"], units["ICW"], units["ECW"] = h.TBWUnit, h.ICWUnit, h.ECWUnit
         }
     }
 
-    // Generate headers for mass measurements with friendly names
-    for i := 0; i < maxMass; i++ {
-        label := ""
-        if i < len(massLabels) {
-            label = massLabels[i]
+    // Collect the measurement blocks of the header, in header order
+    // Mass blocks come first, then percentage blocks
+    massLabels := []string{}
+    percentLabels := []string{}
+    seen := map[string]bool{}
+    for _, col := range records.Columns() {
+        if col.Metric == "" {
+            continue
+        }
+        label := measurementLabel(Measurement{Region: col.Region, Metric: col.Metric})
+        if seen[label] {
+            continue
+        }
+        seen[label] = true
+        if units[label] == "" {
+            units[label] = col.Unit
+        }
+        if strings.Contains(col.Metric, "%") {
+            percentLabels = append(percentLabels, label)
         } else {
-            label = fmt.Sprintf("Mass_%d", i)
+            massLabels = append(massLabels, label)
         }
-        header = append(header,
-            label+"_Total",
-            label+"_Left",
-            label+"_Right",
-            label+"_Delta",
-        )
     }
 
-    // Generate headers for percentage measurements with friendly names
-    for i := 0; i < maxPct; i++ {
-        label := ""
-        if i < len(percentLabels) {
-            label = percentLabels[i]
-        } else {
-            label = fmt.Sprintf("Percent_%d", i)
+    labels := append(massLabels, percentLabels...)
+
+    // Hydration columns present in the header, in hydrationKeys order
+    hydration := []string{}
+    for _, key := range hydrationKeys {
+        for _, col := range records.Columns() {
+            if col.Key == key {
+                hydration = append(hydration, key)
+                if units[key] == "" {
+                    units[key] = col.Unit
+                }
+                break
+            }
         }
+    }
+
+    // Columns with no recognized metric follow, under their key
+    other := []string{}
+    for _, col := range records.Columns() {
+        if isOtherColumn(col) {
+            other = append(other, col.Key)
+        }
+    }
+    if r, ok := first.(BodyFatRecord); ok {
+        for _, v := range r.Other {
+            units[v.Key] = v.Unit
+        }
+    }
+    for _, col := range records.Columns() {
+        if isOtherColumn(col) && units[col.Key] == "" {
+            units[col.Key] = col.Unit
+        }
+    }
+
+    // Start with base identifier columns, then any patient details
+    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    demoKeys, demoUnits, demoHeader := demographicColumns(records.Columns(), first)
+    header = append(header, demoHeader...)
+
+    // Each block contributes Total, Left, Right and Delta columns
+    for _, label := range labels {
+        suffix := unitSuffix(units[label])
         header = append(header,
-            label+"_Total",
-            label+"_Left",
-            label+"_Right",
-            label+"_Delta",
+            label+"_Total"+suffix,
+            label+"_Left"+suffix,
+            label+"_Right"+suffix,
+            label+"_Delta"+suffix,
         )
     }
 
+    // Hydration values follow the measurement blocks, e.g. TBW_L, ICW_L, TBW_Device
+    for _, key := range hydration {
+        header = append(header, key+unitSuffix(units[key]))
+    }
+    for _, key := range other {
+        header = append(header, key+unitSuffix(units[key]))
+    }
+
     // Write the header row
     writer.Write(header)
 
     // Write data rows
-    for _, r := range rows {
-        line := []string{r.ID1, r.ID2, r.ID3, r.Date}
+    n := 0
+    err = forEachRecord(first, records, func(rec interface{}) error {
+        r := rec.(BodyFatRecord)
+        n++
+        cells := &unitCells{record: n}
 
-        // Add all mass measurements
+        line := []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        line = append(line, demographicCells(cells, r.Demographics, demoKeys, demoUnits)...)
+
+        // Index this record's blocks by label so columns line up with the header
+        blocks := map[string]Measurement{}
         for _, m := range r.Mass {
-            line = append(line,
-                fmt.Sprintf("%f", m.Total),
-                fmt.Sprintf("%f", m.Left),
-                fmt.Sprintf("%f", m.Right),
-                fmt.Sprintf("%f", m.Delta),
-            )
+            blocks[measurementLabel(m)] = m
         }
-
-        // Pad with empty strings if this record has fewer mass measurements than max
-        for i := len(r.Mass); i < maxMass; i++ {
-            line = append(line, "", "", "", "")
+        for _, p := range r.Percent {
+            blocks[measurementLabel(p)] = p
         }
 
-        // Add all percentage measurements
-        for _, p := range r.Percent {
+        for _, label := range labels {
+            m, ok := blocks[label]
+            if !ok {
+                // Pad with empty strings if this record lacks the block
+                line = append(line, "", "", "", "")
+                continue
+            }
+            // Values in another unit than the column's are converted to it
+            unit := units[label]
             line = append(line,
-                fmt.Sprintf("%f", p.Total),
-                fmt.Sprintf("%f", p.Left),
-                fmt.Sprintf("%f", p.Right),
-                fmt.Sprintf("%f", p.Delta),
+                cells.cell(m.Total, m.Unit, label, unit),
+                cells.cell(m.Left, m.Unit, label, unit),
+                cells.cell(m.Right, m.Unit, label, unit),
+                cells.cell(m.Delta, m.Unit, label, unit),
             )
         }
 
-        // Pad with empty strings if this record has fewer percent measurements than max
-        for i := len(r.Percent); i < maxPct; i++ {
-            line = append(line, "", "", "", "")
+        h := r.Hydration
+        if h == nil {
+            h = &Hydration{} // Record without hydration columns: empty cells
+        }
+        for _, key := range hydration {
+            switch key {
+            case "TBW":
+                line = append(line, cells.cell(h.TBW, h.TBWUnit, key, units[key]))
+            case "ICW":
+                line = append(line, cells.cell(h.ICW, h.ICWUnit, key, units[key]))
+            case "ECW":
+                line = append(line, cells.cell(h.ECW, h.ECWUnit, key, units[key]))
+            case "TBW_Device":
+                line = append(line, h.TBWDevice)
+            }
         }
 
-        writer.Write(line)
+        values := map[string]TotalBodyValue{}
+        for _, v := range r.Other {
+            values[v.Key] = v
+        }
+        for _, key := range other {
+            v := values[key]
+            line = append(line, cells.cell(v.Value, v.Unit, key, units[key]))
+        }
+
+        if cells.err != nil {
+            return cells.err
+        }
+        return writer.Write(line)
+    })
+    if err != nil {
+        return err
     }
 
     writer.Flush()
     return writer.Error()
 }
 
-// TOTAL BODY — BMD measurements with friendly column names
-func writeCSVTotalBody(w io.Writer, rows []TotalBodyRecord) error {
+// measurementLabel returns the friendly column prefix for a measurement block
+// Example: Region "Arms", Metric "Region %Fat" -> "Arms_Region_Percent_Fat"
+func measurementLabel(m Measurement) string {
+    return sanitizeColumnName(m.Region + " " + m.Metric)
+}
+
+// TOTAL BODY, SPINE, FOREARM and SPEC FORMATS — Keyed values with friendly column names
+// Column names are the normalized keys of the header columns plus their unit
+// (e.g. Head_BMD_g_cm2, Arm_Left_T_Score, L1_L4_BMD_g_cm2, Radius_33pct_BMD_g_cm2),
+// so templates that add or drop regions stay labeled correctly
+func writeCSVKeyedValues(w io.Writer, records RecordIterator) error {
     writer := csv.NewWriter(w)
 
-    // Define all Total Body measurement labels in exact order
-    totalBodyLabels := []string{
-        // BMD measurements (0-16)
-        "Head_BMD",
-        "Arms_BMD",
-        "Legs_BMD",
-        "Trunk_BMD",
-        "Ribs_BMD",
-        "Pelvis_BMD",
-        "Spine_BMD",
-        "Arm_Left_BMD",
-        "Leg_Left_BMD",
-        "Arm_Right_BMD",
-        "Leg_Right_BMD",
-        "Total_BMD",
-        "TBLH_BMD",
-        "Trunk_Left_BMD",
-        "Total_Left_BMD",
-        "Trunk_Right_BMD",
-        "Total_Right_BMD",
-        // BMC measurements (17-33)
-        "Head_BMC",
-        "Arms_BMC",
-        "Legs_BMC",
-        "Trunk_BMC",
-        "Ribs_BMC",
-        "Pelvis_BMC",
-        "Spine_BMC",
-        "Arm_Left_BMC",
-        "Leg_Left_BMC",
-        "Arm_Right_BMC",
-        "Leg_Right_BMC",
-        "Total_BMC",
-        "TBLH_BMC",
-        "Trunk_Left_BMC",
-        "Total_Left_BMC",
-        "Trunk_Right_BMC",
-        "Total_Right_BMC",
-        // Area measurements (34-50)
-        "Head_Area",
-        "Arms_Area",
-        "Legs_Area",
-        "Trunk_Area",
-        "Ribs_Area",
-        "Pelvis_Area",
-        "Spine_Area",
-        "Arm_Left_Area",
-        "Leg_Left_Area",
-        "Arm_Right_Area",
-        "Leg_Right_Area",
-        "Total_Area",
-        "TBLH_Area",
-        "Trunk_Left_Area",
-        "Total_Left_Area",
-        "Trunk_Right_Area",
-        "Total_Right_Area",
-        // T-Scores (51-67)
-        "Head_T_Score",
-        "Arms_T_Score",
-        "Legs_T_Score",
-        "Trunk_T_Score",
-        "Ribs_T_Score",
-        "Pelvis_T_Score",
-        "Spine_T_Score",
-        "Arm_Left_T_Score",
-        "Leg_Left_T_Score",
-        "Arm_Right_T_Score",
-        "Leg_Right_T_Score",
-        "Total_T_Score",
-        "TBLH_T_Score",
-        "Trunk_Left_T_Score",
-        "Total_Left_T_Score",
-        "Trunk_Right_T_Score",
-        "Total_Right_T_Score",
-        // Z-Scores (68-84)
-        "Head_Z_Score",
-        "Arms_Z_Score",
-        "Legs_Z_Score",
-        "Trunk_Z_Score",
-        "Ribs_Z_Score",
-        "Pelvis_Z_Score",
-        "Spine_Z_Score",
-        "Arm_Left_Z_Score",
-        "Leg_Left_Z_Score",
-        "Arm_Right_Z_Score",
-        "Leg_Right_Z_Score",
-        "Total_Z_Score",
-        "TBLH_Z_Score",
-        "Trunk_Left_Z_Score",
-        "Total_Left_Z_Score",
-        "Trunk_Right_Z_Score",
-        "Total_Right_Z_Score",
-        // Average Height (85-101)
-        "Head_Average_Height",
-        "Arms_Average_Height",
-        "Legs_Average_Height",
-        "Trunk_Average_Height",
-        "Ribs_Average_Height",
-        "Pelvis_Average_Height",
-        "Spine_Average_Height",
-        "Arm_Left_Average_Height",
-        "Leg_Left_Average_Height",
-        "Arm_Right_Average_Height",
-        "Leg_Right_Average_Height",
-        "Total_Average_Height",
-        "TBLH_Average_Height",
-        "Trunk_Left_Average_Height",
-        "Total_Left_Average_Height",
-        "Trunk_Right_Average_Height",
-        "Total_Right_Average_Height",
-        // Average Width (102-118)
-        "Head_Average_Width",
-        "Arms_Average_Width",
-        "Legs_Average_Width",
-        "Trunk_Average_Width",
-        "Ribs_Average_Width",
-        "Pelvis_Average_Width",
-        "Spine_Average_Width",
-        "Arm_Left_Average_Width",
-        "Leg_Left_Average_Width",
-        "Arm_Right_Average_Width",
-        "Leg_Right_Average_Width",
-        "Total_Average_Width",
-        "TBLH_Average_Width",
-        "Trunk_Left_Average_Width",
-        "Total_Left_Average_Width",
-        "Trunk_Right_Average_Width",
-        "Total_Right_Average_Width",
-    }
-
-    // Build header with base columns
-    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    first, err := firstRecord(records)
+    if err != nil {
+        return err
+    }
 
-    // Add friendly column names for each measurement
-    for i := range rows[0].Values {
-        if i < len(totalBodyLabels) {
-            header = append(header, totalBodyLabels[i])
-        } else {
-            // Fallback for any additional values beyond our label list
-            header = append(header, fmt.Sprintf("Value_%d", i))
+    // Units of the first record's values, which may come from its cells
+    units := map[string]string{}
+    if first != nil {
+        _, _, units = keyedValues(first)
+    }
+
+    // Collect the keys of the header, in header order
+    keys := []string{}
+    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    demoKeys, demoUnits, demoHeader := demographicColumns(records.Columns(), first)
+    header = append(header, demoHeader...)
+    for _, col := range records.Columns() {
+        if col.Key == "" || isDemographicKey(col.Key) {
+            continue // ID/date fields have no key; patient details are written above
+        }
+        keys = append(keys, col.Key)
+        if units[col.Key] == "" {
+            units[col.Key] = col.Unit
         }
+        header = append(header, col.Key+unitSuffix(units[col.Key]))
     }
 
     writer.Write(header)
 
     // Write each record as a row
-    for _, r := range rows {
-        row := []string{r.ID1, r.ID2, r.ID3, r.Date}
-        
-        // Append all numeric values
+    n := 0
+    err = forEachRecord(first, records, func(rec interface{}) error {
+        n++
+        cells := &unitCells{record: n}
+
+        // Values are indexed by key so columns line up with the header
+        row, values, valueUnits := keyedValues(rec)
+        row = append(row, demographicCells(cells, recordDemographics(rec), demoKeys, demoUnits)...)
+
+        // Keys absent from the record and missing values both give empty cells;
+        // values in another unit than the column's are converted to it
+        for _, k := range keys {
+            row = append(row, cells.cell(values[k], valueUnits[k], k, units[k]))
+        }
+
+        if cells.err != nil {
+            return cells.err
+        }
+        return writer.Write(row)
+    })
+    if err != nil {
+        return err
+    }
+
+    writer.Flush()
+    return writer.Error()
+}
+
+// keyedValues returns the identifier cells of a Total Body, Spine, Forearm or
+// spec-defined record and its values and units indexed by key
+func keyedValues(rec interface{}) (ids []string, values map[string]*float64, units map[string]string) {
+    values = map[string]*float64{}
+    units = map[string]string{}
+
+    switch r := rec.(type) {
+    case TotalBodyRecord:
+        ids = []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        for _, v := range r.Values {
+            values[v.Key], units[v.Key] = v.Value, v.Unit
+        }
+    case SpineRecord:
+        ids = []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        for _, v := range r.Values {
+            values[v.Key], units[v.Key] = v.Value, v.Unit
+        }
+    case ForearmRecord:
+        ids = []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
         for _, v := range r.Values {
-            row = append(row, fmt.Sprintf("%f", v))
+            values[v.Key], units[v.Key] = v.Value, v.Unit
+        }
+    case SpecRecord:
+        ids = []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        for _, v := range r.Values {
+            values[v.Key], units[v.Key] = v.Value, v.Unit
+        }
+    }
+    return ids, values, units
+}
+
+// DUAL FEMUR — Hip BMD by site with friendly column names
+// Each (site, metric) block contributes Left, Right and Mean columns,
+// e.g. Neck_BMD_Left_g_cm2, Neck_BMD_Right_g_cm2, Neck_BMD_Mean_g_cm2, and a
+// Delta column when the header has a difference column for the block
+func writeCSVFemur(w io.Writer, records RecordIterator) error {
+    writer := csv.NewWriter(w)
+
+    first, err := firstRecord(records)
+    if err != nil {
+        return err
+    }
+
+    // Units of the first record's blocks, which may come from its cells
+    units := map[string]string{}
+    if r, ok := first.(FemurRecord); ok {
+        for _, m := range r.Sites {
+            units[femurLabel(m)] = m.Unit
         }
-        
-        writer.Write(row)
+    }
+
+    // Collect the (site, metric) blocks of the header, in header order
+    labels := []string{}
+    seen := map[string]bool{}
+    delta := map[string]bool{}
+    for _, col := range records.Columns() {
+        if col.Metric == "" {
+            continue
+        }
+        label := femurLabel(FemurMeasurement{Site: femurSite(col.Region), Metric: col.Metric})
+        if col.Side == "Delta" {
+            delta[label] = true
+        }
+        if seen[label] {
+            continue
+        }
+        seen[label] = true
+        labels = append(labels, label)
+        if units[label] == "" {
+            units[label] = col.Unit
+        }
+    }
+
+    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    demoKeys, demoUnits, demoHeader := demographicColumns(records.Columns(), first)
+    header = append(header, demoHeader...)
+    for _, label := range labels {
+        suffix := unitSuffix(units[label])
+        header = append(header,
+            label+"_Left"+suffix,
+            label+"_Right"+suffix,
+            label+"_Mean"+suffix,
+        )
+        if delta[label] {
+            header = append(header, label+"_Delta"+suffix)
+        }
+    }
+
+    writer.Write(header)
+
+    // Write data rows
+    n := 0
+    err = forEachRecord(first, records, func(rec interface{}) error {
+        r := rec.(FemurRecord)
+        n++
+        cells := &unitCells{record: n}
+
+        row := []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        row = append(row, demographicCells(cells, r.Demographics, demoKeys, demoUnits)...)
+
+        // Index this record's blocks by label so columns line up with the header
+        blocks := map[string]FemurMeasurement{}
+        for _, m := range r.Sites {
+            blocks[femurLabel(m)] = m
+        }
+
+        for _, label := range labels {
+            m := blocks[label] // A missing block gives empty cells
+            unit := units[label]
+            row = append(row,
+                cells.cell(m.Left, m.Unit, label, unit),
+                cells.cell(m.Right, m.Unit, label, unit),
+                cells.cell(m.Mean, m.Unit, label, unit),
+            )
+            if delta[label] {
+                row = append(row, cells.cell(m.Delta, m.Unit, label, unit))
+            }
+        }
+
+        if cells.err != nil {
+            return cells.err
+        }
+        return writer.Write(row)
+    })
+    if err != nil {
+        return err
     }
 
     writer.Flush()
     return writer.Error()
 }
 
+// femurLabel returns the friendly column prefix for a hip site block
+// Example: Site "Ward's Triangle", Metric "BMD" -> "Wards_Triangle_BMD"
+func femurLabel(m FemurMeasurement) string {
+    return sanitizeColumnName(m.Site + " " + m.Metric)
+}
+
 // CORE SCAN — VAT measurements (already has friendly names)
-func writeCSVCoreScan(w io.Writer, rows []CoreScanRecord) error {
+// The unit suffix follows the export, e.g. VAT_Mass_lbs or VAT_Mass_kg
+func writeCSVCoreScan(w io.Writer, records RecordIterator) error {
     writer := csv.NewWriter(w)
 
+    first, err := firstRecord(records)
+    if err != nil {
+        return err
+    }
+
+    // Label the columns with the units of the first record; values of later
+    // records in another unit are converted to them
+    massUnit, volumeUnit := "", ""
+    if r, ok := first.(CoreScanRecord); ok {
+        massUnit, volumeUnit = r.VATMassUnit, r.VATVolumeUnit
+    }
+
     // Write header with friendly column names
-    writer.Write([]string{
-        "Last_Name",
-        "First_Name",
-        "Patient_ID",
-        "Measure_Date",
-        "VAT_Mass_lbs",
-        "VAT_Volume_in3",
-    })
+    header := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    demoKeys, demoUnits, demoHeader := demographicColumns(records.Columns(), first)
+    header = append(header, demoHeader...)
+    writer.Write(append(header,
+        "VAT_Mass"+unitSuffix(massUnit),
+        "VAT_Volume"+unitSuffix(volumeUnit),
+    ))
 
     // Write each record
-    for _, r := range rows {
-        row := []string{
-            r.ID1,
-            r.ID2,
-            r.ID3,
-            r.Date,
-            fmt.Sprintf("%f", r.VATMass),
-            fmt.Sprintf("%f", r.VATVolume),
+    n := 0
+    err = forEachRecord(first, records, func(rec interface{}) error {
+        r := rec.(CoreScanRecord)
+        n++
+        cells := &unitCells{record: n}
+
+        row := []string{r.ID1, r.ID2, r.ID3, r.Date.String()}
+        row = append(row, demographicCells(cells, r.Demographics, demoKeys, demoUnits)...)
+        row = append(row,
+            cells.cell(r.VATMass, r.VATMassUnit, "VAT_Mass", massUnit),
+            cells.cell(r.VATVolume, r.VATVolumeUnit, "VAT_Volume", volumeUnit),
+        )
+        if cells.err != nil {
+            return cells.err
         }
-        writer.Write(row)
+        return writer.Write(row)
+    })
+    if err != nil {
+        return err
     }
 
     writer.Flush()
     return writer.Error()
 }
 
+// demographicColumns returns the patient detail keys present in the header, in
+// demographicKeys order, and their CSV column names, e.g. Age, Sex, Height_cm
+// Height and weight are labeled with the unit of the first record when its
+// cells give one; units holds the unit of each labeled column
+func demographicColumns(cols []Column, first interface{}) (keys []string, units map[string]string, header []string) {
+    units = map[string]string{}
+    if d := recordDemographics(first); d != nil {
+        units["Height"], units["Weight"] = d.HeightUnit, d.WeightUnit
+    }
+    for _, key := range demographicKeys {
+        for _, col := range cols {
+            if col.Key == key {
+                if units[key] == "" && (key == "Height" || key == "Weight") {
+                    units[key] = col.Unit // Age is always in years
+                }
+                keys = append(keys, key)
+                header = append(header, key+unitSuffix(units[key]))
+                break
+            }
+        }
+    }
+    return keys, units, header
+}
+
+// demographicCells returns the CSV cells of a record's patient details for keys
+// A record without details (nil) gives empty cells. A height or weight in
+// another unit than its column is converted to it, e.g. 70 in -> 177.8 cm
+func demographicCells(cells *unitCells, d *Demographics, keys []string, units map[string]string) []string {
+    if d == nil {
+        d = &Demographics{}
+    }
+    row := []string{}
+    for _, key := range keys {
+        switch key {
+        case "Age":
+            row = append(row, formatValue(d.Age))
+        case "Sex":
+            row = append(row, d.Sex)
+        case "Height":
+            row = append(row, cells.cell(d.Height, d.HeightUnit, key, units[key]))
+        case "Weight":
+            row = append(row, cells.cell(d.Weight, d.WeightUnit, key, units[key]))
+        case "Ethnicity":
+            row = append(row, d.Ethnicity)
+        case "Birth_Date":
+            row = append(row, d.BirthDate.String())
+        }
+    }
+    return row
+}
+
+// unitCells formats the values of one CSV row in the units of their columns
+// The first value that can't be converted is kept in err, and the row is not
+// written
+type unitCells struct {
+    record int // 1-based record number, for errors
+    err    error
+}
+
+// cell formats v, recorded in unit, for column in columnUnit
+// A value in another unit is converted to the column's; a column without a
+// unit keeps the value's unit in the cell (e.g. "0.700000 kg") so it isn't
+// mislabeled
+func (c *unitCells) cell(v *float64, unit, column, columnUnit string) string {
+    if v == nil || unit == "" || unit == columnUnit {
+        return formatValue(v)
+    }
+    if columnUnit == "" {
+        return unitCell(formatValue(v), unit, columnUnit)
+    }
+    x, ok := convertUnit(*v, unit, columnUnit)
+    if !ok {
+        if c.err == nil {
+            c.err = fmt.Errorf("record %d: %s is in %s, which can't be converted to the %s of its CSV column; use --format=json to keep each value's unit", c.record, column, unit, columnUnit)
+        }
+        return ""
+    }
+    return formatValue(&x)
+}
+
+// unitCell adds unit to a non-empty cell when it differs from the column unit
+func unitCell(cell, unit, columnUnit string) string {
+    if cell == "" || unit == "" || unit == columnUnit {
+        return cell
+    }
+    return cell + " " + unit
+}
+
+// unitSizes gives each convertible unit its quantity and its size in the base
+// unit of that quantity (kg, cm, cm³)
+var unitSizes = map[string]struct {
+    quantity string
+    size     float64
+}{
+    "g":   {"mass", 0.001},
+    "kg":  {"mass", 1},
+    "lbs": {"mass", 0.45359237},
+    "cm":  {"length", 1},
+    "in":  {"length", 2.54},
+    "cm³": {"volume", 1},
+    "in³": {"volume", 16.387064},
+    "L":   {"volume", 1000},
+}
+
+// convertUnit converts v from one unit to another of the same quantity
+// Returns false when either unit is unknown or they measure different things
+func convertUnit(v float64, from, to string) (float64, bool) {
+    f, okFrom := unitSizes[from]
+    t, okTo := unitSizes[to]
+    if !okFrom || !okTo || f.quantity != t.quantity {
+        return 0, false
+    }
+    return v * f.size / t.size, true
+}
+
+// recordDemographics returns the patient details of any record type, or nil
+func recordDemographics(rec interface{}) *Demographics {
+    switch r := rec.(type) {
+    case BodyFatRecord:
+        return r.Demographics
+    case TotalBodyRecord:
+        return r.Demographics
+    case CoreScanRecord:
+        return r.Demographics
+    case SpineRecord:
+        return r.Demographics
+    case FemurRecord:
+        return r.Demographics
+    case ForearmRecord:
+        return r.Demographics
+    case SpecRecord:
+        return r.Demographics
+    }
+    return nil
+}
+
+// firstRecord reads the first record ahead of the CSV header
+// Returns nil (and no error) when there are no records
+func firstRecord(records RecordIterator) (interface{}, error) {
+    rec, err := records.Next()
+    if err == io.EOF {
+        return nil, nil
+    }
+    return rec, err
+}
+
+// forEachRecord calls fn for first (if not nil) and then every remaining record
+func forEachRecord(first interface{}, records RecordIterator, fn func(rec interface{}) error) error {
+    for rec := first; rec != nil; {
+        if err := fn(rec); err != nil {
+            return err
+        }
+
+        var err error
+        rec, err = records.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// formatValue formats a measurement for CSV; missing (nil) values become empty cells
+func formatValue(v *float64) string {
+    if v == nil {
+        return ""
+    }
+    return fmt.Sprintf("%f", *v)
+}
+
+// unitSuffix converts a unit into an ASCII column-name suffix
+// Example: "lbs" -> "_lbs", "g/cm²" -> "_g_cm2", "in³" -> "_in3"
+// Percentages return "" because their metric name already says Percent
+func unitSuffix(unit string) string {
+    if unit == "" || unit == "%" {
+        return ""
+    }
+    unit = strings.NewReplacer("²", "2", "³", "3").Replace(unit)
+    return "_" + sanitizeColumnName(unit)
+}
+
 // sanitizeColumnName converts header text to friendly underscore-separated names
 // Example: "Arms Fat Mass" -> "Arms_Fat_Mass"
 //          "Region %Fat" -> "Region_Percent_Fat"
@@ -404,6 +719,7 @@ func sanitizeColumnName(name string) string {
     name = strings.ReplaceAll(name, "/", "_")
     name = strings.ReplaceAll(name, "(", "")
     name = strings.ReplaceAll(name, ")", "")
+    name = strings.ReplaceAll(name, "'", "")
     
     // Remove any double underscores
     for strings.Contains(name, "__") {
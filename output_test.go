@@ -0,0 +1,84 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+// csvOutput converts an input to CSV, as main does for a single section
+func csvOutput(t *testing.T, input string) (string, error) {
+    t.Helper()
+    rr, err := NewRecordReader(strings.NewReader(input), ParseOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var out bytes.Buffer
+    err = OutputCSV(&out, rr)
+    return out.String(), err
+}
+
+func TestCSVUnitConversion(t *testing.T) {
+    input := strings.Join([]string{
+        "Last Name\tFirst Name\tPatient ID\tMeasure Date\tHeight\tVAT Mass\tVAT Volume",
+        "Doe\tJane\tP001\t11/11/2025\t170 cm\t1.5 lbs\t40 in3",
+        "Roe\tJohn\tP002\t11/12/2025\t70 in\t0.7 kg\t700 cm3",
+    }, "\n")
+
+    want := strings.Join([]string{
+        "Last_Name,First_Name,Patient_ID,Measure_Date,Height_cm,VAT_Mass_lbs,VAT_Volume_in3",
+        "Doe,Jane,P001,11/11/2025,170.000000,1.500000,40.000000",
+        "Roe,John,P002,11/12/2025,177.800000,1.543236,42.716621",
+        "",
+    }, "\n")
+
+    got, err := csvOutput(t, input)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got != want {
+        t.Errorf("CSV output:\n%s\nwant:\n%s", got, want)
+    }
+}
+
+func TestCSVUnitMismatch(t *testing.T) {
+    input := strings.Join([]string{
+        "Last Name\tFirst Name\tPatient ID\tMeasure Date\tVAT Mass\tVAT Volume",
+        "Doe\tJane\tP001\t11/11/2025\t1.5 lbs\t40 in3",
+        "Roe\tJohn\tP002\t11/12/2025\t70 %\t700 cm3",
+    }, "\n")
+
+    got, err := csvOutput(t, input)
+    want := "record 2: VAT_Mass is in %, which can't be converted to the lbs of its CSV column"
+    if err == nil || !strings.HasPrefix(err.Error(), want) {
+        t.Errorf("OutputCSV() error = %v, want %q", err, want)
+    }
+    if strings.Contains(got, "Roe") {
+        t.Errorf("the mislabeled row was written:\n%s", got)
+    }
+}
+
+func TestConvertUnit(t *testing.T) {
+    tests := []struct {
+        v        float64
+        from, to string
+        want     float64
+        ok       bool
+    }{
+        {1000, "g", "kg", 1, true},
+        {1, "kg", "lbs", 2.2046226218487757, true},
+        {10, "in", "cm", 25.4, true},
+        {1, "L", "cm³", 1000, true},
+        {1, "in³", "cm³", 16.387064, true},
+        {1, "kg", "L", 0, false},
+        {1, "%", "g", 0, false},
+        {1, "g/cm²", "g/cm²", 0, false}, // Equal units are written as they are before conversion
+    }
+
+    for _, tt := range tests {
+        got, ok := convertUnit(tt.v, tt.from, tt.to)
+        if ok != tt.ok || (ok && (got-tt.want > 1e-9 || tt.want-got > 1e-9)) {
+            t.Errorf("convertUnit(%v, %q, %q) = %v, %v, want %v, %v", tt.v, tt.from, tt.to, got, ok, tt.want, tt.ok)
+        }
+    }
+}
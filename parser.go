@@ -8,237 +8,1194 @@ import (
     "regexp"
     "strconv"
     "strings"
-
-    "golang.org/x/text/encoding/unicode"
-    "golang.org/x/text/transform"
 )
 
 // ErrSkipLine is returned when a line should be ignored (empty or malformed)
 var ErrSkipLine = errors.New("skip")
 
+// skipLine returns an ErrSkipLine error that carries the reason for the skip
+func skipLine(reason string) error {
+    return fmt.Errorf("%w: %s", ErrSkipLine, reason)
+}
+
+// ParseOptions controls how tolerant the parser is of malformed rows
+type ParseOptions struct {
+    // Lenient keeps going past rows that fail to parse: they are skipped and
+    // reported as diagnostics instead of aborting the conversion
+    Lenient bool
+
+    // Strict turns every tolerated irregularity into an error: duplicate header
+    // names, rows whose field count differs from the header, and text in
+    // numeric columns. Strict and Lenient are mutually exclusive
+    Strict bool
+
+    // DateInput selects how the Date column is read: "us" (MM/DD/YYYY, the
+    // default), "eu" (DD/MM/YYYY), "iso" (YYYY-MM-DD) or a custom Go layout
+    // Times of day are accepted after the date, and ISO dates always are
+    DateInput string
+
+    // Vendor selects the export conventions: "ge", "hologic", or "auto"/"" to
+    // identify the vendor from the file (see VendorProfile)
+    Vendor string
+
+    // Type forces the format of every section: "bodycomp", "totalbody", ...
+    // or the name of a spec format. "auto"/"" detects it from each header and
+    // fails when the header matches several formats (see detectDXAType)
+    Type string
+
+    // DecimalSeparator is the decimal separator of the numbers: "." or ",", or
+    // "auto"/"" to detect it from the data rows of each file (see detectDecimal)
+    DecimalSeparator string
+
+    dateLayouts []string // Layouts resolved from DateInput by NewRecordReader
+}
+
 // numericRE matches numeric values including negative numbers, decimals, and comma-separated numbers
 // Examples: "123", "-45.67", "1,234.56", "+0.123"
+// Cells in a decimal-comma notation are rewritten before they get here (see normalizeNumbers)
 var numericRE = regexp.MustCompile(`[-+]?\d[\d,]*\.?\d*`)
 
 // ParseFile is the main entry point for parsing DEXA scanner files
-// It handles UTF-16 LE BOM encoding and automatically detects the file format
+// It expects UTF-8 text (see decodeInput, which converts the UTF-16 LE BOM exports
+// and other encodings) and automatically detects the file format
+// All records are collected in memory; use NewRecordReader to stream large files
+// Files with several sections are combined when every section has the same type;
+// use ParseSections for files that mix types
 // Returns: DXAType (format detected), interface{} (slice of records), error
 func ParseFile(r io.Reader) (DXAType, interface{}, error) {
-    // Create a UTF-16 Little Endian decoder that expects a BOM (Byte Order Mark)
-    // DEXA scanner files use UTF-16 LE encoding with BOM
-    utf16bom := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
-    reader := transform.NewReader(r, utf16bom.NewDecoder())
-    scanner := bufio.NewScanner(reader)
+    sections, err := ParseSections(r, ParseOptions{})
+    if err != nil {
+        return DXATypeUnknown, nil, err
+    }
+
+    t := sections[0].Type
+    for _, s := range sections[1:] {
+        if s.Type != t {
+            return DXATypeUnknown, nil, fmt.Errorf("line %d: section type changes from %s to %s; use ParseSections", s.Line, dxaTypeKeys[t], dxaTypeKeys[s.Type])
+        }
+    }
+
+    // Concatenate the record slices of all sections
+    if all := concatRecords(t, sections); all != nil {
+        return t, all, nil
+    }
+    return DXATypeUnknown, nil, fmt.Errorf("unrecognized file type")
+}
+
+// concatRecords joins the record slices of sections of type t into one slice,
+// e.g. []BodyFatRecord; sections of other types are left out
+// Returns nil for an unknown type
+func concatRecords(t DXAType, sections []Section) interface{} {
+    switch t {
+    case DXATypeBodyComp:
+        all := []BodyFatRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]BodyFatRecord)...)
+            }
+        }
+        return all
+    case DXATypeTotalBody:
+        all := []TotalBodyRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]TotalBodyRecord)...)
+            }
+        }
+        return all
+    case DXATypeCoreScan:
+        all := []CoreScanRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]CoreScanRecord)...)
+            }
+        }
+        return all
+    case DXATypeSpine:
+        all := []SpineRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]SpineRecord)...)
+            }
+        }
+        return all
+    case DXATypeFemur:
+        all := []FemurRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]FemurRecord)...)
+            }
+        }
+        return all
+    case DXATypeForearm:
+        all := []ForearmRecord{}
+        for _, s := range sections {
+            if s.Type == t {
+                all = append(all, s.Records.([]ForearmRecord)...)
+            }
+        }
+        return all
+    default:
+        if specFor(t) != nil {
+            all := []SpecRecord{}
+            for _, s := range sections {
+                if s.Type == t {
+                    all = append(all, s.Records.([]SpecRecord)...)
+                }
+            }
+            return all
+        }
+    }
+    return nil
+}
+
+// Section is one report block of a DEXA export: a header line and the data rows
+// under it. Batch exports can hold several sections, each with its own type
+type Section struct {
+    Type    DXAType     // Format detected from the section header
+    Line    int         // Line number of the section header (1-based)
+    Columns []Column    // Tokenized section header
+    Records interface{} // Record slice of Type, e.g. []BodyFatRecord or []SpineRecord
+}
+
+// ParseSections parses every section of a DEXA export into memory
+// Sections are returned in file order; a single-section file gives one Section
+func ParseSections(r io.Reader, opts ParseOptions) ([]Section, error) {
+    rr, err := NewRecordReader(r, opts)
+    if err != nil {
+        return nil, err
+    }
+    return readSections(rr)
+}
+
+// readSections reads every remaining section of a RecordReader into memory
+func readSections(rr *RecordReader) ([]Section, error) {
+    sections := []Section{}
+    for {
+        s := Section{Type: rr.Type(), Line: rr.SectionLine(), Columns: rr.Columns()}
+
+        // Initialize the slice for this section's type
+        bodycomp := []BodyFatRecord{}   // For body composition (fat mass/percent)
+        totalbody := []TotalBodyRecord{} // For total body BMD measurements
+        corescan := []CoreScanRecord{}   // For visceral adipose tissue (VAT) scans
+        spine := []SpineRecord{}         // For AP spine BMD by vertebra
+        femur := []FemurRecord{}         // For dual femur (hip) BMD by side and site
+        forearm := []ForearmRecord{}     // For forearm (radius/ulna) BMD by site
+        specs := []SpecRecord{}          // For formats defined by spec files
+
+        for {
+            rec, err := rr.Next()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                return nil, err
+            }
+
+            // Append parsed record to the appropriate slice based on its type
+            switch r := rec.(type) {
+            case BodyFatRecord:
+                bodycomp = append(bodycomp, r)
+            case TotalBodyRecord:
+                totalbody = append(totalbody, r)
+            case CoreScanRecord:
+                corescan = append(corescan, r)
+            case SpineRecord:
+                spine = append(spine, r)
+            case FemurRecord:
+                femur = append(femur, r)
+            case ForearmRecord:
+                forearm = append(forearm, r)
+            case SpecRecord:
+                specs = append(specs, r)
+            }
+        }
+
+        switch s.Type {
+        case DXATypeBodyComp:
+            s.Records = bodycomp
+        case DXATypeTotalBody:
+            s.Records = totalbody
+        case DXATypeCoreScan:
+            s.Records = corescan
+        case DXATypeSpine:
+            s.Records = spine
+        case DXATypeFemur:
+            s.Records = femur
+        case DXATypeForearm:
+            s.Records = forearm
+        default:
+            s.Records = specs
+        }
+        sections = append(sections, s)
 
-    lineNum := 0
+        more, err := rr.NextSection()
+        if err != nil {
+            return nil, err
+        }
+        if !more {
+            return sections, nil
+        }
+    }
+}
+
+// RecordReader streams typed records from a DEXA export one data row at a time
+// Only the current line is held in memory, so conversion memory stays flat
+// regardless of input size. It implements RecordIterator
+// A header line found after the data rows starts a new section: Next returns
+// io.EOF at the end of each section and NextSection moves on to the next one
+type RecordReader struct {
+    lines   *lineReader
+    delim   byte            // Field separator detected from the header row
+    opts    ParseOptions
+    lineNum int             // Number of the last line read (1-based)
+    t       DXAType         // Format detected from the current section header
+    forced  DXAType         // Format given by ParseOptions.Type, if any
+    ranked  []TypeCandidate // Formats scored against the current section header
+    cols    []Column        // Tokenized header of the current section
+    vendor  VendorProfile   // Export conventions of the file
+    order   []int           // Column rearrangement of the current section (see normalizeHeader)
+    section int             // Number of the current section (1-based)
+    header  int             // Line number of the current section header
+    next    string          // Header line that ended the current section, if any
+    nextNum int             // Line number of next
+    decimal byte            // Decimal separator of the numbers, 0 until detected
+    decided string          // How decimal was decided: "--decimal-separator", "detected", "assumed" or "XLSX workbook"
+    xlsx    bool            // The rows come from an XLSX worksheet, whose numbers are never rewritten
+    diags   []Diagnostic    // Rows skipped or repaired so far
+    err     error           // First parse or I/O error returned by Next
+}
+
+// NewRecordReader reads the header from r (UTF-8 text) and detects the file format
+// Records are then read on demand with Next
+func NewRecordReader(r io.Reader, opts ParseOptions) (*RecordReader, error) {
+    layouts, err := resolveDateInput(opts.DateInput)
+    if err != nil {
+        return nil, err
+    }
+    opts.dateLayouts = layouts
+    vendor, forced, err := lookupVendor(opts.Vendor)
+    if err != nil {
+        return nil, err
+    }
+    forcedType, err := lookupDXAType(opts.Type)
+    if err != nil {
+        return nil, err
+    }
+    // Worksheet numbers are stored with a decimal point, whatever the locale
+    _, xlsx := r.(worksheetText)
+
+    // The tool's own JSON output is rebuilt into an export first
+    br := bufio.NewReader(r)
+    r = br
+    if looksLikeJSON(br) {
+        if r, err = jsonOutputText(br); err != nil {
+            return nil, err
+        }
+    }
+
+    rr := &RecordReader{lines: newLineReader(r), opts: opts, vendor: vendor, forced: forcedType, xlsx: xlsx}
+    switch opts.DecimalSeparator {
+    case ".", ",":
+        rr.decimal, rr.decided = opts.DecimalSeparator[0], "--decimal-separator"
+    case "", "auto":
+    default:
+        return nil, fmt.Errorf("invalid decimal separator %q: use auto, . or ,", opts.DecimalSeparator)
+    }
+    if xlsx {
+        rr.decimal, rr.decided = '.', "XLSX workbook"
+    }
     header := ""
 
     // Find the first non-empty line, which contains the header
     // The header determines the file type (BodyComp, TotalBody, or CoreScan)
-    for scanner.Scan() {
-        lineNum++
-        raw := strings.TrimSpace(scanner.Text())
-        if raw == "" {
+    // Lines are not trimmed as a whole so trailing empty cells keep their position
+    for rr.lines.Scan() {
+        rr.lineNum = rr.lines.Line()
+        raw := rr.lines.Text()
+        if strings.TrimSpace(raw) == "" {
             continue // Skip empty lines
         }
-        header = raw
+
+        // The header row decides how fields are separated: tab in the scanner's
+        // export, comma or semicolon in a copy re-saved from a spreadsheet
+        rr.delim = detectDelimiter(raw)
+
+        // A short line naming the scanner software may precede the header
+        // (a spreadsheet may have padded it with empty cells)
+        if v, ok := vendorBanner(raw); ok && countCells(raw, rr.delim) < 4 {
+            if !forced {
+                rr.vendor = v
+            } else if v.Vendor == rr.vendor.Vendor {
+                rr.vendor.Version = v.Version
+            }
+            continue
+        }
+
+        header = rr.tabFields(raw)
         break // Found header, exit loop
     }
 
+    // Check for any read errors (I/O issues, etc.)
+    if err := rr.lines.Err(); err != nil {
+        return nil, err
+    }
+
     // Validate that we found a header
     if header == "" {
-        return DXATypeUnknown, nil, fmt.Errorf("empty file")
+        return nil, fmt.Errorf("empty file")
     }
 
-    // Detect which DEXA format this file contains based on header content
-    t := detectDXAType(header)
+    // Without a banner the vendor is recognized by its column names
+    if rr.vendor.Vendor == "" {
+        rr.vendor = identifyVendor(header)
+    }
 
-    // Initialize slices to hold records for each possible file type
-    bodycomp := []BodyFatRecord{}   // For body composition (fat mass/percent)
-    totalbody := []TotalBodyRecord{} // For total body BMD measurements
-    corescan := []CoreScanRecord{}   // For visceral adipose tissue (VAT) scans
+    if err := rr.startSection(header, rr.lineNum); err != nil {
+        if rr.t == DXATypeUnknown {
+            return nil, err // Keep the message short for files that aren't DEXA exports
+        }
+        return nil, fmt.Errorf("line %d: %w", rr.lineNum, err)
+    }
+    return rr, nil
+}
 
-    // Parse all remaining data lines
-    for scanner.Scan() {
-        lineNum++
-        raw := strings.TrimSpace(scanner.Text())
-        if raw == "" {
-            continue // Skip empty lines
+// tabFields returns a row of the input in the tab-delimited form the parser
+// works with. Rows of a comma- or semicolon-delimited file are split with
+// RFC 4180 quoting; a quoted field that spans lines pulls in the following
+// lines, and the row keeps the number of its first line. Tabs and line breaks
+// inside a field become spaces so the field stays in one cell
+func (rr *RecordReader) tabFields(line string) string {
+    if rr.delim == '\t' && !strings.Contains(line, `"`) {
+        return line // Scanner export: nothing to convert
+    }
+
+    fields, open := splitFields(line, rr.delim)
+    for open && rr.lines.Scan() {
+        line += "\n" + rr.lines.Text()
+        fields, open = splitFields(line, rr.delim)
+    }
+    spaces := strings.NewReplacer("\t", " ", "\n", " ")
+    for i, f := range fields {
+        fields[i] = spaces.Replace(f)
+    }
+    return strings.Join(fields, "\t")
+}
+
+// DecimalSeparator describes the decimal separator of the numbers and how it
+// was decided, e.g. "comma (detected)" or "point (assumed)"
+func (rr *RecordReader) DecimalSeparator() string {
+    return fmt.Sprintf("%s (%s)", decimalNames[rr.decimal], rr.decided)
+}
+
+// countCells returns the number of non-blank fields of a line
+func countCells(line string, delim byte) int {
+    fields, _ := splitFields(line, delim)
+    n := 0
+    for _, f := range fields {
+        if strings.TrimSpace(f) != "" {
+            n++
         }
+    }
+    return n
+}
 
-        // Parse the data line according to detected file type
-        rec, err := parseDataLine(t, raw)
-        if err != nil {
-            if errors.Is(err, ErrSkipLine) {
-                continue // Skip lines that are intentionally ignored
-            }
-            // Return error with line number for debugging
-            return DXATypeUnknown, nil, fmt.Errorf("line %d: %w", lineNum, err)
+// Delimiter returns the name of the field separator detected from the header
+// row: "tab", "comma" or "semicolon"
+func (rr *RecordReader) Delimiter() string {
+    return delimiterNames[rr.delim]
+}
+
+// startSection detects the format of a header line and tokenizes its columns
+// The vendor profile first rewrites the header in the common layout and vocabulary
+func (rr *RecordReader) startSection(header string, line int) error {
+    source := strings.Split(header, "\t")
+    header, rr.order = rr.vendor.normalizeHeader(header)
+
+    // Detect which DEXA format this section contains based on header content
+    what := "file"
+    if rr.section > 0 {
+        what = "section"
+    }
+    var err error
+    rr.t, rr.ranked, err = detectDXAType(header, rr.forced, what)
+    if err != nil {
+        return err
+    }
+
+    // Tokenize the header so each data cell can be matched to its column by name
+    rr.cols = parseHeader(header)
+    if rr.t == DXATypeForearm {
+        forearmColumns(rr.cols) // Canonical site names and friendly keys
+    }
+    if spec := specFor(rr.t); spec != nil {
+        spec.applyColumns(rr.cols) // Mapping from the spec file
+    }
+
+    // Keep the header text of the export for messages and output labels
+    if rr.order != nil {
+        source = reorderFields(source, rr.order)
+    }
+    for i := range rr.cols {
+        rr.cols[i].Name = strings.TrimSpace(source[i])
+    }
+    rr.section++
+    rr.header = line
+
+    // Until the data rows prove the decimal separator, each section samples its own
+    if rr.decimal == 0 || rr.decided == "assumed" {
+        rr.detectDecimal()
+    }
+
+    // Duplicate names make the column a value belongs to ambiguous
+    if rr.opts.Strict {
+        if err := checkDuplicateColumns(rr.cols); err != nil {
+            return err
         }
+    }
+    return nil
+}
 
-        // Append parsed record to the appropriate slice based on detected type
-        switch t {
-        case DXATypeBodyComp:
-            bodycomp = append(bodycomp, rec.(BodyFatRecord))
-        case DXATypeTotalBody:
-            totalbody = append(totalbody, rec.(TotalBodyRecord))
-        case DXATypeCoreScan:
-            corescan = append(corescan, rec.(CoreScanRecord))
+// isHeaderLine reports whether a line inside the data starts a new section:
+// either it identifies a DEXA format, or one of its cells is a date column name
+// (the current header's, or the vendor's), as in a section whose vocabulary only
+// the vendor profile understands or whose type this tool doesn't know
+func (rr *RecordReader) isHeaderLine(line string) bool {
+    if len(matchDXATypes(line)) > 0 {
+        return true
+    }
+    for _, f := range strings.Split(line, "\t") {
+        name := strings.TrimSpace(f)
+        if name == "" {
+            continue
+        }
+        if (len(rr.cols) > 3 && strings.EqualFold(name, rr.cols[3].Name)) || rr.vendor.isDateColumn(name) {
+            return true
         }
     }
+    return false
+}
 
-    // Check for any scanner errors (I/O issues, etc.)
-    if err := scanner.Err(); err != nil {
-        return DXATypeUnknown, nil, err
+// Candidates returns the formats scored against the current section header,
+// best first (see scoreDXATypes)
+func (rr *RecordReader) Candidates() []TypeCandidate {
+    return rr.ranked
+}
+
+// Forced reports whether the format was given by ParseOptions.Type
+func (rr *RecordReader) Forced() bool {
+    return rr.forced != DXATypeUnknown
+}
+
+// Vendor returns the export conventions identified for the file
+func (rr *RecordReader) Vendor() VendorProfile {
+    return rr.vendor
+}
+
+// Type returns the DEXA format detected from the current section header
+func (rr *RecordReader) Type() DXAType {
+    return rr.t
+}
+
+// Columns returns the tokenized header of the current section
+func (rr *RecordReader) Columns() []Column {
+    return rr.cols
+}
+
+// Section returns the number of the current section (1-based)
+func (rr *RecordReader) Section() int {
+    return rr.section
+}
+
+// SectionLine returns the line number of the current section header
+func (rr *RecordReader) SectionLine() int {
+    return rr.header
+}
+
+// NextSection skips any records left in the current section and moves to the
+// next one. Returns false when the file has no more sections
+func (rr *RecordReader) NextSection() (bool, error) {
+    for {
+        if _, err := rr.Next(); err == io.EOF {
+            break
+        } else if err != nil {
+            return false, err
+        }
+    }
+    if rr.next == "" {
+        return false, nil
     }
 
-    // Return the appropriate slice based on detected file type
-    switch t {
-    case DXATypeBodyComp:
-        return t, bodycomp, nil
-    case DXATypeTotalBody:
-        return t, totalbody, nil
-    case DXATypeCoreScan:
-        return t, corescan, nil
+    header, line := rr.next, rr.nextNum
+    rr.next = ""
+    if err := rr.startSection(header, line); err != nil {
+        rr.err = fmt.Errorf("line %d: %w", line, err)
+        return false, rr.err
     }
+    return true, nil
+}
 
-    return DXATypeUnknown, nil, fmt.Errorf("unrecognized file type")
+// Diagnostics returns the rows skipped or repaired so far
+// Rows that are not measurement data (fewer than 4 fields, no values) are always
+// reported, and so are the problems worked around in the rows that are kept
+// (text in a numeric column, a short row, ...); in lenient mode rows that fail
+// to parse are reported too
+func (rr *RecordReader) Diagnostics() []Diagnostic {
+    return rr.diags
 }
 
-// detectDXAType examines the header row to determine which DEXA format the file contains
-// Detection is based on distinctive column names unique to each format:
-// - BodyComp: contains "arms fat mass" 
-// - TotalBody: contains "head bmd" (bone mineral density)
-// - CoreScan: contains "vat mass" (visceral adipose tissue)
-func detectDXAType(header string) DXAType {
-    h := strings.ToLower(header)
+// Next parses and returns the next record (BodyFatRecord, TotalBodyRecord,
+// CoreScanRecord, SpineRecord, FemurRecord, ForearmRecord or SpecRecord,
+// matching Type). Returns io.EOF
+// after the last record of the current section
+func (rr *RecordReader) Next() (interface{}, error) {
+    if rr.err != nil {
+        return nil, rr.err
+    }
+    if rr.next != "" {
+        return nil, io.EOF // Waiting for NextSection
+    }
 
-    switch {
-    case strings.Contains(h, "arms fat mass"):
-        return DXATypeBodyComp
-    case strings.Contains(h, "head bmd"):
-        return DXATypeTotalBody
-    case strings.Contains(h, "vat mass"):
-        return DXATypeCoreScan
+    for rr.lines.Scan() {
+        rr.lineNum = rr.lines.Line()
+        raw := rr.tabFields(rr.lines.Text())
+        if strings.TrimSpace(raw) == "" {
+            continue // Skip empty lines (a spreadsheet writes them as ",,,")
+        }
+
+        // A new header ends the current section
+        if rr.isHeaderLine(raw) {
+            rr.next, rr.nextNum = raw, rr.lineNum
+            return nil, io.EOF
+        }
+
+        // Problems worked around while parsing the row (short rows, stray text,
+        // numbers that don't fit the decimal separator) are reported whatever the
+        // mode: a value may have been lost or guessed
+        issues := []string{}
+        onIssue := func(reason string) error {
+            if rr.opts.Strict {
+                return errors.New(reason)
+            }
+            issues = append(issues, reason)
+            return nil
+        }
+
+        // Rearrange the cells like the header when the vendor's layout differs
+        line := raw
+        if rr.order != nil {
+            line = strings.Join(reorderFields(strings.Split(raw, "\t"), rr.order), "\t")
+        }
+
+        var err error
+        if !rr.xlsx {
+            line, err = rr.normalizeNumbers(line, onIssue)
+        }
+
+        // Parse the data line according to detected file type
+        var rec interface{}
+        if err == nil {
+            rec, err = parseDataLine(rr.t, rr.cols, rr.opts, line, onIssue)
+        }
+        if err != nil {
+            if errors.Is(err, ErrSkipLine) {
+                // Skip lines that are intentionally ignored, but leave a trace
+                reason := strings.TrimPrefix(err.Error(), ErrSkipLine.Error()+": ")
+                rr.diags = append(rr.diags, newDiagnostic(rr.lineNum, reason, raw, ActionSkipped))
+                continue
+            }
+            if rr.opts.Lenient {
+                // Keep the good records and report the bad one
+                rr.diags = append(rr.diags, newDiagnostic(rr.lineNum, err.Error(), raw, ActionSkipped))
+                continue
+            }
+            // Return error with line number for debugging
+            rr.err = fmt.Errorf("line %d: %w", rr.lineNum, err)
+            return nil, rr.err
+        }
+
+        for _, reason := range issues {
+            rr.diags = append(rr.diags, newDiagnostic(rr.lineNum, reason, raw, ActionRepaired))
+        }
+        return rec, nil
     }
-    return DXATypeUnknown
+
+    // Check for any read errors (I/O issues, etc.)
+    if err := rr.lines.Err(); err != nil {
+        rr.err = err
+        return nil, err
+    }
+    return nil, io.EOF
+}
+
+// Err returns the error that stopped the reader, if any
+// It lets callers tell parse failures apart from output errors while streaming
+func (rr *RecordReader) Err() error {
+    return rr.err
 }
 
 // parseDataLine parses a single tab-delimited data row based on the detected file type
 // All DEXA formats share the first 4 columns: ID1, ID2, ID3, Date
-// Remaining columns vary by format and contain measurement data
-func parseDataLine(t DXAType, line string) (interface{}, error) {
+// Remaining columns vary by format and contain measurement data; cols is the
+// tokenized header used to identify each cell by position, and opts supplies the
+// accepted date layouts
+// onIssue is called for each problem that can be worked around (a row shorter or
+// longer than the header, text in a numeric column); a non-nil return aborts the row
+func parseDataLine(t DXAType, cols []Column, opts ParseOptions, line string, onIssue func(reason string) error) (interface{}, error) {
     // Split by tab character (DEXA files are tab-delimited)
     fields := strings.Split(line, "\t")
+
+    // Cells are matched to the header by position; report rows that don't line up
+    // (missing values are left empty, extra values are ignored)
+    if len(fields) != len(cols) {
+        if err := onIssue(fmt.Sprintf("row has %d fields, header has %d", len(fields), len(cols))); err != nil {
+            return nil, err
+        }
+    }
     
     // Require at least 4 fields (the common ID/date columns)
     if len(fields) < 4 {
-        return nil, ErrSkipLine
+        return nil, skipLine(fmt.Sprintf("row has %d fields, expected at least 4 (ID1, ID2, ID3, Date)", len(fields)))
     }
 
     // Extract the common fields present in all formats
     id1 := strings.TrimSpace(fields[0])  // Patient/Subject ID
     id2 := strings.TrimSpace(fields[1])  // Secondary ID
     id3 := strings.TrimSpace(fields[2])  // Tertiary ID
-    date := strings.TrimSpace(fields[3]) // Scan date
+
+    // Scan date; an unparseable date is an error rather than passed through
+    date, err := parseScanDate(fields[3], opts.dateLayouts)
+    if err != nil {
+        name := "Date" // A header shorter than the row has no name for it
+        if len(cols) > 3 {
+            name = cols[3].Name
+        }
+        return nil, fmt.Errorf("column 4 %q: %w, expected %s", name, err, describeDateInput(opts.DateInput))
+    }
+
+    // Patient details (age, sex, height, ...) are read by header name, so they
+    // never end up among the measurements
+    demo, err := readDemographics(cols, fields, opts, onIssue)
+    if err != nil {
+        return nil, err
+    }
 
     switch t {
 
     // BODY COMPOSITION FORMAT
     // Contains fat mass and fat percentage for body regions (arms, legs, trunk, etc.)
-    // Data structure: first half is mass measurements, second half is percentages
-    // Each measurement has 4 values: Total, Left, Right, Delta
+    // Each header column names its region, metric and side (Total, Left, Right, Delta)
+    // Percentage metrics ("Region %Fat", "Tissue %Fat") go to Percent, the rest to Mass
     case DXATypeBodyComp:
-        // Extract all numeric values from remaining columns
-        nums := extractNumbers(fields[4:])
-        if len(nums) == 0 {
-            return nil, ErrSkipLine
+        rec := BodyFatRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo}
+        found, err := groupMeasurements(&rec, cols, fields, onIssue)
+        if err != nil {
+            return nil, err
+        }
+        hydrated := false
+        rec.Hydration, hydrated, err = readHydration(cols, fields, onIssue)
+        if err != nil {
+            return nil, err
+        }
+        other := false
+        rec.Other, other, err = readOtherValues(cols, fields, onIssue)
+        if err != nil {
+            return nil, err
+        }
+        if !found && !hydrated && !other {
+            return nil, skipLine("no numeric values in any measurement column")
         }
-
-        rec := BodyFatRecord{ID1: id1, ID2: id2, ID3: id3, Date: date}
-        
-        // Split numbers in half: first half = mass, second half = percent
-        rec.Mass = groupMeasurements(nums[:len(nums)/2])
-        rec.Percent = groupMeasurements(nums[len(nums)/2:])
         return rec, nil
 
     // TOTAL BODY FORMAT
     // Contains bone mineral density (BMD) and other body composition values
-    // Simple flat array of measurements
+    // Each value is labeled with the header column it came from; every header
+    // column yields a value, nil when the cell is missing
     case DXATypeTotalBody:
-        nums := extractNumbers(fields[4:])
-        rec := TotalBodyRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Values: nums}
+        rec := TotalBodyRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo, Values: []TotalBodyValue{}}
+        found := false
+        for _, col := range cols {
+            if col.Index < 4 || col.Key == "" || isDemographicKey(col.Key) {
+                continue // ID/date field, blank header cell or patient detail
+            }
+            v, unit, err := cellNumber(col, fields, onIssue)
+            if err != nil {
+                return nil, err
+            }
+            found = found || v != nil
+            rec.Values = append(rec.Values, TotalBodyValue{
+                Name:  col.Name,
+                Key:   col.Key,
+                Unit:  unit,
+                Value: v,
+            })
+        }
+        if !found {
+            return nil, skipLine("no numeric values in any measurement column")
+        }
+        return rec, nil
+
+    // AP SPINE FORMAT
+    // Contains BMD, BMC, area, T-score and Z-score per vertebra (L1-L4) and range
+    // (L1-L4, L2-L4, ...); read like Total Body, with the decoded region and
+    // metric kept on each value
+    case DXATypeSpine:
+        rec := SpineRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo, Values: []SpineValue{}}
+        found := false
+        for _, col := range cols {
+            if col.Index < 4 || col.Key == "" || isDemographicKey(col.Key) {
+                continue // ID/date field, blank header cell or patient detail
+            }
+            v, unit, err := cellNumber(col, fields, onIssue)
+            if err != nil {
+                return nil, err
+            }
+            found = found || v != nil
+            rec.Values = append(rec.Values, SpineValue{
+                Name:   col.Name,
+                Region: col.Region,
+                Metric: col.Metric,
+                Key:    col.Key,
+                Unit:   unit,
+                Value:  v,
+            })
+        }
+        if !found {
+            return nil, skipLine("no numeric values in any measurement column")
+        }
+        return rec, nil
+
+    // FOREARM FORMAT
+    // Contains BMD, BMC, area, T-score and Z-score per radius/ulna site (33%,
+    // mid, ultra-distal, total); read like Total Body, with the site in Region
+    // Sites the tool doesn't know keep the key derived from their header text
+    case DXATypeForearm:
+        rec := ForearmRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo, Values: []ForearmValue{}}
+        found := false
+        for _, col := range cols {
+            if col.Index < 4 || col.Key == "" || isDemographicKey(col.Key) {
+                continue // ID/date field, blank header cell or patient detail
+            }
+            v, unit, err := cellNumber(col, fields, onIssue)
+            if err != nil {
+                return nil, err
+            }
+            found = found || v != nil
+            rec.Values = append(rec.Values, ForearmValue{
+                Name:   col.Name,
+                Region: col.Region,
+                Side:   col.Side,
+                Metric: col.Metric,
+                Key:    col.Key,
+                Unit:   unit,
+                Value:  v,
+            })
+        }
+        if !found {
+            return nil, skipLine("no numeric values in any measurement column")
+        }
+        return rec, nil
+
+    // DUAL FEMUR (HIP) FORMAT
+    // Contains BMD, BMC, area, T-score and Z-score per site (neck, trochanter,
+    // shaft, Ward's triangle, total hip) for the left and right hip and their mean
+    // Columns are grouped by (site, metric) like Body Composition measurements
+    case DXATypeFemur:
+        rec := FemurRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo, Sites: []FemurMeasurement{}}
+        found, err := groupFemurSites(&rec, cols, fields, onIssue)
+        if err != nil {
+            return nil, err
+        }
+        if !found {
+            return nil, skipLine("no numeric values in any measurement column")
+        }
         return rec, nil
 
     // CORE SCAN FORMAT (VAT - Visceral Adipose Tissue)
-    // Contains exactly 2 measurements: VAT mass (lbs) and VAT volume (in³)
+    // Contains exactly 2 measurements: VAT mass (typically lbs) and VAT volume (in³)
+    // Both are located by header name and keep the unit given in the export
     case DXATypeCoreScan:
-        nums := extractNumbers(fields[4:])
-        if len(nums) < 2 {
-            return nil, fmt.Errorf("corescan row missing numeric fields")
-        }
-        rec := CoreScanRecord{
-            ID1:       id1,
-            ID2:       id2,
-            ID3:       id3,
-            Date:      date,
-            VATMass:   nums[0], // Visceral adipose tissue mass in pounds
-            VATVolume: nums[1], // Visceral adipose tissue volume in cubic inches
+        rec := CoreScanRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo}
+        for _, col := range cols {
+            var err error
+            switch col.Metric {
+            case "VAT Mass":
+                rec.VATMass, rec.VATMassUnit, err = cellNumber(col, fields, onIssue)
+            case "VAT Volume":
+                rec.VATVolume, rec.VATVolumeUnit, err = cellNumber(col, fields, onIssue)
+            }
+            if err != nil {
+                return nil, err
+            }
+        }
+        if rec.VATMass == nil && rec.VATVolume == nil {
+            return nil, skipLine("no numeric values in any measurement column")
         }
         return rec, nil
     }
 
-    return nil, ErrSkipLine
+    // SPEC-DEFINED FORMATS
+    // Read like Total Body; the columns were mapped by the spec when the header
+    // was read (see FormatSpec.applyColumns)
+    if specFor(t) == nil {
+        return nil, ErrSkipLine
+    }
+    rec := SpecRecord{ID1: id1, ID2: id2, ID3: id3, Date: date, Demographics: demo, Values: []SpecValue{}}
+    found := false
+    for _, col := range cols {
+        if col.Index < 4 || col.Key == "" || isDemographicKey(col.Key) {
+            continue // ID/date field, blank header cell or patient detail
+        }
+        v, unit, err := cellNumber(col, fields, onIssue)
+        if err != nil {
+            return nil, err
+        }
+        found = found || v != nil
+        rec.Values = append(rec.Values, SpecValue{
+            Name:   col.Name,
+            Region: col.Region,
+            Side:   col.Side,
+            Metric: col.Metric,
+            Key:    col.Key,
+            Unit:   unit,
+            Value:  v,
+        })
+    }
+    if !found {
+        return nil, skipLine("no numeric values in any measurement column")
+    }
+    return rec, nil
 }
 
-// extractNumbers extracts all numeric values from an array of field strings
-// Uses regex to find numbers that may include:
-// - Negative/positive signs
-// - Comma thousands separators (e.g., "1,234.56")
-// - Decimal points
-// Returns a flat array of float64 values
-func extractNumbers(fields []string) []float64 {
-    vals := []float64{}
+// groupMeasurements fills the Mass and Percent blocks of a Body Composition record
+// Columns are grouped by (region, metric) in header order; each column's side
+// selects the Total, Left, Right or Delta slot of its block. Regions without
+// left/right columns (e.g. Android, Gynoid) simply leave those slots unset
+// Returns false when the row holds no numeric measurement at all
+// onIssue is forwarded to cellNumber for text found in numeric columns
+func groupMeasurements(rec *BodyFatRecord, cols []Column, fields []string, onIssue func(string) error) (bool, error) {
+    // Position of each (region, metric) block within Mass or Percent
+    blocks := map[string]int{}
+    found := false
 
-    for _, f := range fields {
-        // Find all numeric patterns in this field
-        matches := numericRE.FindAllString(f, -1)
-        for _, m := range matches {
-            // Remove comma separators before parsing
-            m = strings.ReplaceAll(m, ",", "")
-            if m == "" {
-                continue
+    for _, col := range cols {
+        if col.Index < 4 || col.Metric == "" {
+            continue // ID/date field or unrecognized column (see readOtherValues)
+        }
+
+        // Find or create the block for this region/metric pair
+        percent := strings.Contains(col.Metric, "%")
+        key := col.Region + "|" + col.Metric
+        idx, ok := blocks[key]
+        if !ok {
+            m := Measurement{Region: col.Region, Metric: col.Metric, Unit: col.Unit}
+            if percent {
+                idx = len(rec.Percent)
+                rec.Percent = append(rec.Percent, m)
+            } else {
+                idx = len(rec.Mass)
+                rec.Mass = append(rec.Mass, m)
             }
-            // Convert string to float64
-            if v, err := strconv.ParseFloat(m, 64); err == nil {
-                vals = append(vals, v)
+            blocks[key] = idx
+        }
+
+        v, unit, err := cellNumber(col, fields, onIssue)
+        if err != nil {
+            return false, err
+        }
+        if v == nil {
+            continue // Missing value stays nil
+        }
+        found = true
+
+        var m *Measurement
+        if percent {
+            m = &rec.Percent[idx]
+        } else {
+            m = &rec.Mass[idx]
+        }
+        if unit != "" {
+            m.Unit = unit // A unit written in the cell wins over the header's
+        }
+        switch col.Side {
+        case "Left":
+            m.Left = v
+        case "Right":
+            m.Right = v
+        case "Delta":
+            m.Delta = v
+        default:
+            m.Total = v
+        }
+    }
+
+    return found, nil
+}
+
+// groupFemurSites fills the site blocks of a Dual Femur record
+// Columns are grouped by (site, metric) in header order; each column's side
+// selects the Left, Right, Mean or Delta slot of its block. A column without a
+// side (single-hip reports) fills Mean
+// Returns false when the row holds no numeric measurement at all
+func groupFemurSites(rec *FemurRecord, cols []Column, fields []string, onIssue func(string) error) (bool, error) {
+    // Position of each (site, metric) block within Sites
+    blocks := map[string]int{}
+    found := false
+
+    for _, col := range cols {
+        if col.Index < 4 || col.Metric == "" {
+            continue // ID/date field or unrecognized column
+        }
+
+        site := femurSite(col.Region)
+        key := site + "|" + col.Metric
+        idx, ok := blocks[key]
+        if !ok {
+            idx = len(rec.Sites)
+            rec.Sites = append(rec.Sites, FemurMeasurement{Site: site, Metric: col.Metric, Unit: col.Unit})
+            blocks[key] = idx
+        }
+
+        v, unit, err := cellNumber(col, fields, onIssue)
+        if err != nil {
+            return false, err
+        }
+        if v == nil {
+            continue // Missing value stays nil
+        }
+        found = true
+
+        m := &rec.Sites[idx]
+        if unit != "" {
+            m.Unit = unit // A unit written in the cell wins over the header's
+        }
+        switch col.Side {
+        case "Left":
+            m.Left = v
+        case "Right":
+            m.Right = v
+        case "Delta":
+            m.Delta = v
+        default:
+            m.Mean = v
+        }
+    }
+
+    return found, nil
+}
+
+// readHydration reads the TBW, ICW, ECW and TBW Device columns of a Body
+// Composition row. Returns nil when the header has none of them, and false when
+// none of them holds a value
+// onIssue is forwarded to cellNumber for text found in numeric columns
+func readHydration(cols []Column, fields []string, onIssue func(string) error) (*Hydration, bool, error) {
+    h := &Hydration{}
+    present, found := false, false
+
+    for _, col := range cols {
+        if col.Index < 4 {
+            continue // ID/date field
+        }
+
+        var v *float64
+        var err error
+        switch col.Key {
+        case "TBW":
+            v, h.TBWUnit, err = cellNumber(col, fields, onIssue)
+            h.TBW = v
+        case "ICW":
+            v, h.ICWUnit, err = cellNumber(col, fields, onIssue)
+            h.ICW = v
+        case "ECW":
+            v, h.ECWUnit, err = cellNumber(col, fields, onIssue)
+            h.ECW = v
+        case "TBW_Device":
+            // The device is a name, not a measurement
+            h.TBWDevice = cellText(col, fields)
+            present = true
+            found = found || h.TBWDevice != ""
+            continue
+        default:
+            continue
+        }
+        if err != nil {
+            return nil, false, err
+        }
+        present = true
+        found = found || v != nil
+    }
+
+    if !present {
+        return nil, false, nil
+    }
+    return h, found, nil
+}
+
+// isOtherColumn reports whether a Body Composition column is a measurement
+// with no recognized metric, such as "Android/Gynoid Ratio", rather than a
+// region block, body water or patient detail column
+func isOtherColumn(col Column) bool {
+    return col.Index >= 4 && col.Key != "" && col.Metric == "" && !isHydrationKey(col.Key) && !isDemographicKey(col.Key)
+}
+
+// readOtherValues reads the Body Composition columns with no recognized metric
+// (see isOtherColumn) under their header key, as Total Body does, so they
+// aren't lost. Returns false when none of them holds a value
+// onIssue is forwarded to cellNumber for text found in numeric columns
+func readOtherValues(cols []Column, fields []string, onIssue func(string) error) ([]TotalBodyValue, bool, error) {
+    values := []TotalBodyValue{}
+    found := false
+    for _, col := range cols {
+        if !isOtherColumn(col) {
+            continue
+        }
+        v, unit, err := cellNumber(col, fields, onIssue)
+        if err != nil {
+            return nil, false, err
+        }
+        found = found || v != nil
+        values = append(values, TotalBodyValue{Name: col.Name, Key: col.Key, Unit: unit, Value: v})
+    }
+    if len(values) == 0 {
+        return nil, false, nil
+    }
+    return values, found, nil
+}
+
+// readDemographics reads the patient detail columns of a row (see
+// demographicNames). Returns nil when the header has none of them
+// onIssue is called for text in a numeric column and for a birth date that
+// doesn't match the date input layouts; the value is then left empty
+func readDemographics(cols []Column, fields []string, opts ParseOptions, onIssue func(string) error) (*Demographics, error) {
+    d := &Demographics{}
+    present := false
+
+    for _, col := range cols {
+        if col.Index < 4 || !isDemographicKey(col.Key) {
+            continue
+        }
+        present = true
+
+        var err error
+        switch col.Key {
+        case "Age":
+            d.Age, _, err = cellNumber(col, fields, onIssue)
+        case "Height":
+            d.Height, d.HeightUnit, err = cellNumber(col, fields, onIssue)
+        case "Weight":
+            d.Weight, d.WeightUnit, err = cellNumber(col, fields, onIssue)
+        case "Sex":
+            d.Sex = cellText(col, fields)
+        case "Ethnicity":
+            d.Ethnicity = cellText(col, fields)
+        case "Birth_Date":
+            if cell := cellText(col, fields); cell != "" {
+                var perr error
+                d.BirthDate, perr = parseScanDate(cell, opts.dateLayouts)
+                if perr != nil {
+                    err = onIssue(fmt.Sprintf("column %d %q: %v, expected %s", col.Index+1, col.Name, perr, describeDateInput(opts.DateInput)))
+                }
             }
         }
+        if err != nil {
+            return nil, err
+        }
     }
 
-    return vals
+    if !present {
+        return nil, nil
+    }
+    return d, nil
 }
 
-// groupMeasurements converts a flat array of numbers into structured Measurement blocks
-// Each measurement consists of 4 consecutive values:
-// - Total: total measurement for both sides
-// - Left: left side measurement
-// - Right: right side measurement  
-// - Delta: difference between left and right
-// This pattern repeats for each body region (arms, legs, trunk, etc.)
-func groupMeasurements(nums []float64) []Measurement {
-    out := []Measurement{}
-    
-    // Process numbers in groups of 4
-    for len(nums) >= 4 {
-        out = append(out, Measurement{
-            Total: nums[0],
-            Left:  nums[1],
-            Right: nums[2],
-            Delta: nums[3],
-        })
-        nums = nums[4:] // Advance to next group
+// cellText returns the trimmed text of the cell under col
+// Blank cells, missing placeholders and cells beyond a short row give ""
+func cellText(col Column, fields []string) string {
+    if col.Index >= len(fields) {
+        return ""
     }
-    
-    return out
+    cell := strings.TrimSpace(fields[col.Index])
+    if missingValues[strings.ToLower(cell)] {
+        return ""
+    }
+    return cell
+}
+
+// missingValues are the cell contents exports use for "no measurement"
+var missingValues = map[string]bool{
+    "-": true, "--": true, "---": true, "n/a": true, "na": true, "nan": true, "null": true,
+}
+
+// cellNumber returns the numeric value of the cell under col and its unit
+// The unit is the cell's own suffix ("12.5 lbs", "31%") when present, otherwise
+// the unit from the column header (which may be empty)
+// Returns a nil value for missing cells: blank, a placeholder such as "--" or
+// "N/A", or beyond the end of a short row
+// Problems are reported through onIssue: text with no number in it (treated as
+// missing) and a number mixed with other text (the number is kept)
+func cellNumber(col Column, fields []string, onIssue func(string) error) (*float64, string, error) {
+    if col.Index >= len(fields) {
+        return nil, col.Unit, nil // Row is shorter than the header
+    }
+    cell := strings.TrimSpace(fields[col.Index])
+    if cell == "" || missingValues[strings.ToLower(cell)] {
+        return nil, col.Unit, nil
+    }
+
+    v, ok := parseNumber(cell)
+    if !ok {
+        reason := fmt.Sprintf("column %d %q: non-numeric value %q", col.Index+1, col.Name, cell)
+        return nil, col.Unit, onIssue(reason)
+    }
+
+    // Anything around the number other than a unit suffix is unexpected
+    unit := col.Unit
+    loc := numericRE.FindStringIndex(cell)
+    prefix := strings.TrimSpace(cell[:loc[0]])
+    suffix := strings.TrimSpace(cell[loc[1]:])
+    switch {
+    case prefix == "" && suffix == "":
+        // Plain number
+    case prefix == "" && isKnownUnit(suffix):
+        unit = normalizeUnit(suffix)
+    default:
+        reason := fmt.Sprintf("column %d %q: unexpected text in numeric value %q", col.Index+1, col.Name, cell)
+        if err := onIssue(reason); err != nil {
+            return nil, "", err
+        }
+    }
+    return &v, unit, nil
+}
+
+// checkDuplicateColumns returns an error naming the first header name that
+// appears more than once (blank header cells are ignored)
+func checkDuplicateColumns(cols []Column) error {
+    seen := map[string]int{}
+    for _, col := range cols {
+        if col.Name == "" {
+            continue
+        }
+        name := strings.ToLower(col.Name)
+        if first, ok := seen[name]; ok {
+            return fmt.Errorf("duplicate header name %q in columns %d and %d", col.Name, first+1, col.Index+1)
+        }
+        seen[name] = col.Index
+    }
+    return nil
+}
+
+// parseNumber extracts the numeric value of a single cell
+// Comma thousands separators are removed ("1,234.5" -> 1234.5)
+// Returns false when the cell holds no number
+func parseNumber(cell string) (float64, bool) {
+    m := numericRE.FindString(cell)
+    m = strings.ReplaceAll(m, ",", "")
+    if m == "" {
+        return 0, false
+    }
+    v, err := strconv.ParseFloat(m, 64)
+    if err != nil {
+        return 0, false
+    }
+    return v, true
 }
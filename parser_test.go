@@ -0,0 +1,19 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestShortHeaderDateError(t *testing.T) {
+    // The row is longer than the header, which has no column 4 to name
+    input := "Name\tArms Fat Mass\na\tb\tc\tbaddate\t1\n"
+    rr, err := NewRecordReader(strings.NewReader(input), ParseOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = rr.Next()
+    if err == nil || !strings.Contains(err.Error(), `column 4 "Date": unrecognized date "baddate"`) {
+        t.Errorf("Next() error = %v, want an unrecognized date in column 4 \"Date\"", err)
+    }
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// The converter's own CSV and JSON outputs can be read back as input, so old
+// conversions can be re-converted or merged once the scanner exports are gone
+// - CSV outputs are recognized by their Measure_Date column (see the "dxafile"
+//   vendor profile); outputColumnName turns friendly column names such as
+//   Arms_Fat_Mass_Total_lbs back into export names such as "Arms Fat Mass (lbs)"
+// - JSON outputs are rebuilt into a tab-delimited export (see jsonOutputText),
+//   one section per run of records of the same type
+
+// outputUnitSuffixes are the unit suffixes written by unitSuffix, longest first
+// so "_g_cm2" wins over "_cm2"
+var outputUnitSuffixes = func() []string {
+    suffixes := []string{}
+    for u := range knownUnits {
+        if s := unitSuffix(u); s != "" {
+            suffixes = append(suffixes, s)
+        }
+    }
+    sort.Slice(suffixes, func(i, j int) bool {
+        if len(suffixes[i]) != len(suffixes[j]) {
+            return len(suffixes[i]) > len(suffixes[j])
+        }
+        return suffixes[i] < suffixes[j]
+    })
+    return suffixes
+}()
+
+// outputRepeatRE matches the suffix that tells repeated keys apart
+var outputRepeatRE = regexp.MustCompile(`_[2-9][0-9]*$`)
+
+// outputColumnName translates a CSV column written by this tool back into the
+// export vocabulary, e.g. "Arms_Fat_Mass_Total_lbs" -> "Arms Fat Mass (lbs)",
+// "Neck_BMD_Left_g_cm2" -> "Neck BMD Left (g/cm²)", "TBW_L" -> "TBW (L)"
+// Names that aren't friendly column names (they contain spaces) are returned
+// unchanged
+func outputColumnName(name string) string {
+    if strings.Contains(name, " ") || strings.Contains(name, "(") {
+        return name
+    }
+
+    unit := ""
+    for _, s := range outputUnitSuffixes {
+        if strings.HasSuffix(name, s) && len(name) > len(s) {
+            for u := range knownUnits {
+                if unitSuffix(u) == s {
+                    unit = u
+                }
+            }
+            name = strings.TrimSuffix(name, s)
+            break
+        }
+    }
+
+    // Repeated columns get a "_2", "_3", ... key suffix (see uniqueKeys)
+    if m := outputRepeatRE.FindStringIndex(name); m != nil {
+        if _, metric, _ := decodeColumnName(strings.ReplaceAll(name[:m[0]], "_", " ")); metric != "" {
+            name = name[:m[0]]
+        }
+    }
+
+    name = strings.ReplaceAll(name, "_", " ")
+
+    // Body Composition blocks write the combined value as "..._Total"
+    if rest := strings.TrimSuffix(name, " Total"); rest != name {
+        if _, metric, _ := decodeColumnName(rest); metric != "" {
+            name = rest
+        }
+    }
+
+    if unit != "" {
+        name += " (" + unit + ")"
+    }
+    return name
+}
+
+// looksLikeJSON reports whether the input starts with a JSON array, as written
+// by OutputJSON. Leading white space is skipped; nothing is consumed
+func looksLikeJSON(br *bufio.Reader) bool {
+    for n := 1; ; n++ {
+        b, err := br.Peek(n)
+        if err != nil || len(b) < n {
+            return false
+        }
+        c := rune(b[n-1])
+        if !unicode.IsSpace(c) {
+            return c == '['
+        }
+        if n >= br.Size() {
+            return false
+        }
+    }
+}
+
+// outputRecord holds any record written by OutputJSON
+// Only the fields of the record's own type are set
+type outputRecord struct {
+    ID1          string              `json:"id1"`
+    ID2          string              `json:"id2"`
+    ID3          string              `json:"id3"`
+    Date         *string             `json:"date"`
+    Demographics *outputDemographics `json:"demographics"`
+    Section      int                 `json:"section"` // Section of a combined output, 0 if untagged
+
+    Mass      []Measurement `json:"mass"`      // Body Composition
+    Percent   []Measurement `json:"percent"`   // Body Composition
+    Hydration *Hydration    `json:"hydration"` // Body Composition
+    Other     []SpecValue   `json:"other"`     // Body Composition
+
+    Values []SpecValue `json:"values"` // Total Body, Spine, Forearm and spec formats
+
+    Sites []FemurMeasurement `json:"sites"` // Dual Femur
+
+    VATMass       *float64 `json:"vat_mass"` // Core Scan
+    VATMassUnit   string   `json:"vat_mass_unit"`
+    VATVolume     *float64 `json:"vat_volume"`
+    VATVolumeUnit string   `json:"vat_volume_unit"`
+
+    // Core Scan keys written before units were read from the export
+    VATMassLbs   *float64 `json:"vat_mass_lbs"`
+    VATVolumeIn3 *float64 `json:"vat_volume_in3"`
+
+    kind string // Record type by its fields: "bodycomp", "values", "femur" or "corescan"
+}
+
+// outputDemographics is Demographics as written in JSON
+type outputDemographics struct {
+    Age        *float64 `json:"age"`
+    Sex        string   `json:"sex"`
+    Height     *float64 `json:"height"`
+    HeightUnit string   `json:"height_unit"`
+    Weight     *float64 `json:"weight"`
+    WeightUnit string   `json:"weight_unit"`
+    Ethnicity  string   `json:"ethnicity"`
+    BirthDate  *string  `json:"birth_date"`
+}
+
+// outputCell is one column of a rebuilt export row
+type outputCell struct {
+    id    string // Identity of the column within a section
+    name  string // Header text, without the unit
+    unit  string // Unit of the value
+    value string // Cell text
+}
+
+// jsonOutputText rebuilds the tab-delimited export that a JSON output was
+// converted from, so it can be parsed like any other input. Each run of records
+// of the same type becomes a section whose header holds every column used by
+// its records, in first-seen order
+// The whole JSON document is read into memory
+func jsonOutputText(r io.Reader) (io.Reader, error) {
+    raw := []json.RawMessage{}
+    if err := json.NewDecoder(r).Decode(&raw); err != nil {
+        return nil, fmt.Errorf("reading JSON output: %w", err)
+    }
+
+    var text strings.Builder
+    section := []outputRecord{}
+    kind := ""
+    for i, data := range raw {
+        rec := outputRecord{}
+        fields := map[string]json.RawMessage{}
+        if err := json.Unmarshal(data, &fields); err != nil {
+            return nil, fmt.Errorf("reading JSON output: record %d: %w", i+1, err)
+        }
+        if what := legacyOutput(fields); what != "" {
+            return nil, fmt.Errorf("reading JSON output: record %d is output from an older version, with %s that have no names; it can't be read back, convert the scanner export again", i+1, what)
+        }
+        if err := json.Unmarshal(data, &rec); err != nil {
+            return nil, fmt.Errorf("reading JSON output: record %d: %w", i+1, err)
+        }
+        rec.kind = outputKind(fields)
+        if rec.kind == "" {
+            return nil, fmt.Errorf("reading JSON output: record %d has no measurements", i+1)
+        }
+
+        if k := outputSectionKey(rec); k != kind && len(section) > 0 {
+            writeOutputSection(&text, section)
+            section = section[:0]
+        }
+        kind = outputSectionKey(rec)
+        section = append(section, rec)
+    }
+    writeOutputSection(&text, section)
+    return strings.NewReader(text.String()), nil
+}
+
+// outputKind identifies the record type of a JSON output record by its fields
+func outputKind(fields map[string]json.RawMessage) string {
+    has := func(name string) bool {
+        _, ok := fields[name]
+        return ok
+    }
+    switch {
+    case has("mass") || has("percent") || has("hydration"):
+        return "bodycomp"
+    case has("sites"):
+        return "femur"
+    case has("values"):
+        return "values"
+    case has("vat_mass") || has("vat_volume") || has("vat_mass_lbs") || has("vat_volume_in3"):
+        return "corescan"
+    }
+    return ""
+}
+
+// legacyOutput describes the unnamed values of a record written before
+// values carried their names: Body Composition blocks without region and
+// metric, and Total Body values as bare numbers. Their position can't be
+// matched to a column, as blank cells were left out. Returns "" for a record
+// in the current layout
+func legacyOutput(fields map[string]json.RawMessage) string {
+    for _, key := range []string{"mass", "percent"} {
+        blocks := []map[string]json.RawMessage{}
+        if json.Unmarshal(fields[key], &blocks) != nil {
+            continue
+        }
+        for _, b := range blocks {
+            if _, ok := b["metric"]; !ok {
+                return "Body Composition " + key + " blocks"
+            }
+        }
+    }
+
+    values := []json.RawMessage{}
+    if json.Unmarshal(fields["values"], &values) == nil {
+        for _, v := range values {
+            if t := strings.TrimSpace(string(v)); t != "" && t[0] != '{' {
+                return "Total Body values"
+            }
+        }
+    }
+    return ""
+}
+
+// outputSectionKey groups records into sections: records are kept in the
+// section they are tagged with, and records with values are told apart by the
+// format their header names identify (Total Body, Spine, ...)
+func outputSectionKey(rec outputRecord) string {
+    if rec.kind != "values" {
+        return fmt.Sprint(rec.Section, rec.kind)
+    }
+    names := []string{}
+    for _, v := range rec.Values {
+        names = append(names, outputColumnName(v.Key+unitSuffix(v.Unit)))
+    }
+    return fmt.Sprint(rec.Section, rec.kind, matchDXATypes(strings.Join(names, "\t")))
+}
+
+// writeOutputSection writes the header and rows of one section of records
+func writeOutputSection(text *strings.Builder, records []outputRecord) {
+    if len(records) == 0 {
+        return
+    }
+
+    // Union of the columns of every record, in first-seen order
+    rows := [][]outputCell{}
+    header := []outputCell{}
+    seen := map[string]bool{}
+    for _, rec := range records {
+        row := outputCells(rec)
+        for _, c := range row {
+            if !seen[c.id] {
+                seen[c.id] = true
+                header = append(header, c)
+            }
+        }
+        rows = append(rows, row)
+    }
+
+    // The header takes the unit of the column's first value; cells in another
+    // unit keep theirs, e.g. "70 in" under "Height (cm)"
+    names := []string{"Last_Name", "First_Name", "Patient_ID", "Measure_Date"}
+    for _, c := range header {
+        name := c.name
+        if c.unit != "" && headerUnit(name) == "" && !strings.Contains(name, "%") {
+            name += " (" + c.unit + ")"
+        }
+        names = append(names, name)
+    }
+    units := map[string]string{}
+    for _, c := range header {
+        units[c.id] = c.unit
+    }
+    text.WriteString(strings.Join(names, "\t") + "\n")
+
+    for i, rec := range records {
+        date := ""
+        if rec.Date != nil {
+            date = *rec.Date
+        }
+        cells := map[string]string{}
+        for _, c := range rows[i] {
+            cells[c.id] = unitCell(c.value, c.unit, units[c.id])
+        }
+        line := []string{outputText(rec.ID1), outputText(rec.ID2), outputText(rec.ID3), date}
+        for _, c := range header {
+            line = append(line, cells[c.id])
+        }
+        text.WriteString(strings.Join(line, "\t") + "\n")
+    }
+}
+
+// outputCells returns the measurement columns of a JSON output record, named
+// as a scanner export would name them
+func outputCells(rec outputRecord) []outputCell {
+    cells := []outputCell{}
+    add := func(name, unit, value string) {
+        cells = append(cells, outputCell{id: name, name: name, unit: unit, value: value})
+    }
+
+    // Patient details and body water are optional columns: only those with a
+    // value are kept
+    optional := func(name, unit, value string) {
+        if value != "" {
+            add(name, unit, value)
+        }
+    }
+
+    if d := rec.Demographics; d != nil {
+        optional("Age", "", outputNumber(d.Age))
+        optional("Sex", "", outputText(d.Sex))
+        optional("Height", d.HeightUnit, outputNumber(d.Height))
+        optional("Weight", d.WeightUnit, outputNumber(d.Weight))
+        optional("Ethnicity", "", outputText(d.Ethnicity))
+        if d.BirthDate != nil {
+            optional("Birth Date", "", *d.BirthDate)
+        }
+    }
+
+    switch rec.kind {
+    case "bodycomp":
+        for _, m := range append(rec.Mass, rec.Percent...) {
+            base := m.Region + " " + m.Metric
+            add(base, m.Unit, outputNumber(m.Total))
+            add(base+" Left", m.Unit, outputNumber(m.Left))
+            add(base+" Right", m.Unit, outputNumber(m.Right))
+            add(base+" Delta", m.Unit, outputNumber(m.Delta))
+        }
+        if h := rec.Hydration; h != nil {
+            optional("TBW", h.TBWUnit, outputNumber(h.TBW))
+            optional("ICW", h.ICWUnit, outputNumber(h.ICW))
+            optional("ECW", h.ECWUnit, outputNumber(h.ECW))
+            optional("TBW Device", "", outputText(h.TBWDevice))
+        }
+        for _, v := range rec.Other {
+            name := outputColumnName(v.Key)
+            cells = append(cells, outputCell{id: v.Key, name: name, unit: v.Unit, value: outputNumber(v.Value)})
+        }
+    case "values":
+        // Columns are named after the key, as in a CSV output: the source
+        // header text may be in a vendor's vocabulary (L1_BMD, TOT_T, ...)
+        for _, v := range rec.Values {
+            name := outputColumnName(v.Key+unitSuffix(v.Unit))
+            cells = append(cells, outputCell{id: v.Key, name: name, value: outputNumber(v.Value)})
+        }
+    case "femur":
+        for _, m := range rec.Sites {
+            base := m.Site + " " + m.Metric
+            add(base+" Left", m.Unit, outputNumber(m.Left))
+            add(base+" Right", m.Unit, outputNumber(m.Right))
+            add(base+" Mean", m.Unit, outputNumber(m.Mean))
+            if m.Delta != nil {
+                add(base+" Delta", m.Unit, outputNumber(m.Delta))
+            }
+        }
+    case "corescan":
+        if rec.VATMass == nil && rec.VATMassLbs != nil {
+            rec.VATMass, rec.VATMassUnit = rec.VATMassLbs, "lbs"
+        }
+        if rec.VATVolume == nil && rec.VATVolumeIn3 != nil {
+            rec.VATVolume, rec.VATVolumeUnit = rec.VATVolumeIn3, "in³"
+        }
+        add("VAT Mass", rec.VATMassUnit, outputNumber(rec.VATMass))
+        add("VAT Volume", rec.VATVolumeUnit, outputNumber(rec.VATVolume))
+    }
+    return cells
+}
+
+// outputNumber formats a value for a rebuilt export row; nil gives an empty cell
+func outputNumber(v *float64) string {
+    if v == nil {
+        return ""
+    }
+    return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// outputText keeps a text value within its cell of a rebuilt export row
+func outputText(s string) string {
+    return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestLegacyJSONOutput(t *testing.T) {
+    // test.json was written by the first release: blocks and values by position only
+    data, err := os.ReadFile("test.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name  string
+        input string
+        want  string // Start of the error
+    }{
+        {"body composition", string(data), "reading JSON output: record 1 is output from an older version, with Body Composition mass blocks"},
+        {"total body", `[{"id1": "a", "id2": "b", "id3": "c", "date": "11/11/2025", "values": [1.2, 3]}]`, "reading JSON output: record 1 is output from an older version, with Total Body values"},
+        {"empty blocks", `[{"id1": "a", "id2": "b", "id3": "c", "date": "11/11/2025", "mass": [{}]}]`, "reading JSON output: record 1 is output from an older version, with Body Composition mass blocks"},
+    }
+
+    for _, tt := range tests {
+        _, err := NewRecordReader(strings.NewReader(tt.input), ParseOptions{})
+        if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+            t.Errorf("%s: NewRecordReader() error = %v, want %q", tt.name, err, tt.want)
+        }
+    }
+}
+
+func TestLegacyCoreScanKeys(t *testing.T) {
+    input := `[{"id1": "a", "id2": "b", "id3": "c", "date": "11/11/2025", "vat_mass_lbs": 1.5, "vat_volume_in3": 48}]`
+    rr, err := NewRecordReader(strings.NewReader(input), ParseOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    rec, err := rr.Next()
+    if err != nil {
+        t.Fatal(err)
+    }
+    c := rec.(CoreScanRecord)
+    if c.VATMass == nil || *c.VATMass != 1.5 || c.VATMassUnit != "lbs" || c.VATVolume == nil || *c.VATVolume != 48 || c.VATVolumeUnit != "in³" {
+        t.Errorf("record = %+v, want 1.5 lbs and 48 in³", c)
+    }
+}
@@ -9,51 +9,216 @@ const (
     DXATypeBodyComp                  // Body Composition: fat mass & percentage by body region
     DXATypeTotalBody                 // Total Body: BMD and body composition measurements
     DXATypeCoreScan                  // Core Scan: visceral adipose tissue (VAT) measurements
+    DXATypeSpine                     // AP Spine: BMD by vertebra (L1-L4) and vertebral range
+    DXATypeFemur                     // Dual Femur: hip BMD by side and site
+    DXATypeForearm                   // Forearm: radius/ulna BMD by site
 )
 
+// dxaTypeKeys are short names for each format, used in output file names
+var dxaTypeKeys = map[DXAType]string{
+    DXATypeBodyComp:  "bodycomp",
+    DXATypeTotalBody: "totalbody",
+    DXATypeCoreScan:  "corescan",
+    DXATypeSpine:     "spine",
+    DXATypeFemur:     "femur",
+    DXATypeForearm:   "forearm",
+}
+
 // Measurement represents a symmetric body measurement with left/right comparison
 // Used in Body Composition format for body regions (arms, legs, trunk, etc.)
+// Region and Metric come from the header, e.g. "Arms" + "Fat Mass"
+// Values are nil when the export has no column for them (e.g. Android has no
+// left/right split) or the cell is blank, "--" or "N/A"; nil is written as null
 type Measurement struct {
-    Total float64 `json:"total"` // Combined measurement for both sides
-    Left  float64 `json:"left"`  // Left side measurement
-    Right float64 `json:"right"` // Right side measurement
-    Delta float64 `json:"delta"` // Difference between left and right (asymmetry indicator)
+    Region string   `json:"region"`         // Body region the values belong to
+    Metric string   `json:"metric"`         // Measurement type (e.g. "Fat Mass", "Region %Fat")
+    Unit   string   `json:"unit,omitempty"` // Unit of all four values (e.g. "lbs", "%"), if given
+    Total  *float64 `json:"total"`          // Combined measurement for both sides
+    Left   *float64 `json:"left"`           // Left side measurement
+    Right  *float64 `json:"right"`          // Right side measurement
+    Delta  *float64 `json:"delta"`          // Difference between left and right (asymmetry indicator)
 }
 
 // BodyFatRecord represents a Body Composition scan
 // Contains fat mass and fat percentage for multiple body regions
 // Each region has measurements for total, left, right, and delta values
+// Measurements appear in header order, one per (region, metric) pair
 // Example regions: arms, legs, trunk, android, gynoid, total body
 type BodyFatRecord struct {
-    ID1     string        `json:"id1"`               // Primary patient/subject identifier
-    ID2     string        `json:"id2"`               // Secondary identifier
-    ID3     string        `json:"id3"`               // Tertiary identifier
-    Date    string        `json:"date"`              // Scan date
-    Mass    []Measurement `json:"mass,omitempty"`    // Fat mass measurements by region (in grams or kg)
-    Percent []Measurement `json:"percent,omitempty"` // Fat percentage measurements by region
+    ID1          string           `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string           `json:"id2"`                    // Secondary identifier
+    ID3          string           `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate         `json:"date"`                   // Scan date
+    Demographics *Demographics    `json:"demographics,omitempty"` // Patient details, when the export has them
+    Mass         []Measurement    `json:"mass,omitempty"`         // Fat mass measurements by region (in grams or kg)
+    Percent      []Measurement    `json:"percent,omitempty"`      // Fat percentage measurements by region
+    Hydration    *Hydration       `json:"hydration,omitempty"`    // Body water estimates, when the export has them
+    Other        []TotalBodyValue `json:"other,omitempty"`        // Columns with no recognized metric, keyed like Total Body values
+}
+
+// Hydration holds the body water estimates some Body Composition exports append
+// after the region columns, matched by header name ("TBW", "Total Body Water", ...)
+// Values are nil when the cell is blank or the export lacks the column
+type Hydration struct {
+    TBW       *float64 `json:"tbw"`                  // Total Body Water
+    TBWUnit   string   `json:"tbw_unit,omitempty"`   // Unit of TBW (e.g. "L", "kg"), if given
+    ICW       *float64 `json:"icw"`                  // Intracellular Water
+    ICWUnit   string   `json:"icw_unit,omitempty"`   // Unit of ICW, if given
+    ECW       *float64 `json:"ecw"`                  // Extracellular Water
+    ECWUnit   string   `json:"ecw_unit,omitempty"`   // Unit of ECW, if given
+    TBWDevice string   `json:"tbw_device,omitempty"` // Device the water estimate came from (free text)
+}
+
+// Demographics holds the patient details some exports place between the IDs and
+// the measurements. Each field is read by header name (see demographicNames);
+// values are nil or empty when the column is missing or blank
+type Demographics struct {
+    Age        *float64 `json:"age"`                   // Age at the scan, in years
+    Sex        string   `json:"sex,omitempty"`         // Sex as given in the export, e.g. "F", "Male"
+    Height     *float64 `json:"height"`                // Height
+    HeightUnit string   `json:"height_unit,omitempty"` // Unit of Height (e.g. "cm", "in"), if given
+    Weight     *float64 `json:"weight"`                // Weight
+    WeightUnit string   `json:"weight_unit,omitempty"` // Unit of Weight (e.g. "kg", "lbs"), if given
+    Ethnicity  string   `json:"ethnicity,omitempty"`   // Ethnicity as given in the export
+    BirthDate  ScanDate `json:"birth_date"`            // Birth date, read like the scan date
 }
 
 // TotalBodyRecord represents a Total Body scan
 // Contains bone mineral density (BMD) and comprehensive body composition values
-// The exact meaning of each value depends on the column order in the source file
+// Each value carries the header column it was read from, so its meaning no longer
+// depends on column order and templates that add or drop regions label correctly
 // Common measurements include: head BMD, arms BMD, legs BMD, trunk BMD, total BMD,
-// tissue percentages, lean mass, fat mass, etc.
+// BMC, area, T-scores, Z-scores, average height and width
 type TotalBodyRecord struct {
-    ID1    string    `json:"id1"`    // Primary patient/subject identifier
-    ID2    string    `json:"id2"`    // Secondary identifier
-    ID3    string    `json:"id3"`    // Tertiary identifier
-    Date   string    `json:"date"`   // Scan date
-    Values []float64 `json:"values"` // Array of measurements (BMD, mass, percentages, etc.)
+    ID1          string           `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string           `json:"id2"`                    // Secondary identifier
+    ID3          string           `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate         `json:"date"`                   // Scan date
+    Demographics *Demographics    `json:"demographics,omitempty"` // Patient details, when the export has them
+    Values       []TotalBodyValue `json:"values"`                 // Measurements in header order (BMD, BMC, area, etc.)
+}
+
+// TotalBodyValue is a single Total Body measurement labeled by its source column
+// Every header column produces a value; Value is nil when the cell is missing
+type TotalBodyValue struct {
+    Name  string   `json:"name"`           // Source header text, e.g. "Arm Left BMD"
+    Key   string   `json:"key"`            // Normalized region/side/metric key, e.g. "Arm_Left_BMD"
+    Unit  string   `json:"unit,omitempty"` // Unit from the cell or header (e.g. "g/cm²"), if given
+    Value *float64 `json:"value"`          // Measured value, nil when missing
+}
+
+// SpineRecord represents an AP (anterior-posterior) Spine scan
+// Contains BMD, BMC, area, T-score and Z-score for each lumbar vertebra (L1-L4)
+// and for combined ranges such as L1-L4 and L2-L4
+// Like TotalBodyRecord, each value carries the header column it was read from
+type SpineRecord struct {
+    ID1          string        `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string        `json:"id2"`                    // Secondary identifier
+    ID3          string        `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate      `json:"date"`                   // Scan date
+    Demographics *Demographics `json:"demographics,omitempty"` // Patient details, when the export has them
+    Values       []SpineValue  `json:"values"`                 // Measurements in header order
+}
+
+// SpineValue is a single AP Spine measurement labeled by its source column
+// Every header column produces a value; Value is nil when the cell is missing
+type SpineValue struct {
+    Name   string   `json:"name"`             // Source header text, e.g. "L1-L4 BMD (g/cm²)"
+    Region string   `json:"region,omitempty"` // Vertebra or range, e.g. "L2", "L1-L4"
+    Metric string   `json:"metric,omitempty"` // Measurement type, e.g. "BMD", "T-Score"
+    Key    string   `json:"key"`              // Normalized region/metric key, e.g. "L1_L4_BMD"
+    Unit   string   `json:"unit,omitempty"`   // Unit from the cell or header (e.g. "g/cm²"), if given
+    Value  *float64 `json:"value"`            // Measured value, nil when missing
+}
+
+// FemurRecord represents a Dual Femur (hip) scan
+// Contains BMD, BMC, area, T-score and Z-score for each hip site, measured on the
+// left and right femur and averaged; each (site, metric) pair is one block
+// Example sites: Neck, Trochanter, Shaft, Ward's Triangle, Total
+type FemurRecord struct {
+    ID1          string             `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string             `json:"id2"`                    // Secondary identifier
+    ID3          string             `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate           `json:"date"`                   // Scan date
+    Demographics *Demographics      `json:"demographics,omitempty"` // Patient details, when the export has them
+    Sites        []FemurMeasurement `json:"sites"`                  // Measurements by site and metric, in header order
+}
+
+// FemurMeasurement holds one metric of one hip site for both sides, their mean
+// and, when the export gives it, their difference
+// Values are nil when the export has no column for them or the cell is missing
+type FemurMeasurement struct {
+    Site   string   `json:"site"`            // Hip site, e.g. "Neck", "Ward's Triangle", "Total"
+    Metric string   `json:"metric"`          // Measurement type, e.g. "BMD", "T-Score"
+    Unit   string   `json:"unit,omitempty"`  // Unit of all the values (e.g. "g/cm²"), if given
+    Left   *float64 `json:"left"`            // Left hip
+    Right  *float64 `json:"right"`           // Right hip
+    Mean   *float64 `json:"mean"`            // Mean of both hips (or the only hip of a single-hip report)
+    Delta  *float64 `json:"delta,omitempty"` // Difference between left and right, when the export has it
+}
+
+// ForearmRecord represents a Forearm scan
+// Contains BMD, BMC, area, T-score and Z-score for radius and ulna sites
+// (33%, mid, ultra-distal, total); like TotalBodyRecord, each value carries the
+// header column it was read from
+type ForearmRecord struct {
+    ID1          string         `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string         `json:"id2"`                    // Secondary identifier
+    ID3          string         `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate       `json:"date"`                   // Scan date
+    Demographics *Demographics  `json:"demographics,omitempty"` // Patient details, when the export has them
+    Values       []ForearmValue `json:"values"`                 // Measurements in header order
+}
+
+// ForearmValue is a single Forearm measurement labeled by its source column
+// Every header column produces a value; Value is nil when the cell is missing
+type ForearmValue struct {
+    Name   string   `json:"name"`             // Source header text, e.g. "Radius 1/3 BMD (g/cm²)"
+    Region string   `json:"region,omitempty"` // Site, e.g. "Radius 33%", "Radius Ultra-Distal"
+    Side   string   `json:"side,omitempty"`   // "Left" or "Right" when the header names the arm
+    Metric string   `json:"metric,omitempty"` // Measurement type, e.g. "BMD", "T-Score"
+    Key    string   `json:"key"`              // Friendly key, e.g. "Radius_33pct_BMD"
+    Unit   string   `json:"unit,omitempty"`   // Unit from the cell or header (e.g. "g/cm²"), if given
+    Value  *float64 `json:"value"`            // Measured value, nil when missing
+}
+
+// SpecRecord represents a scan of a format defined by a spec file (see FormatSpec)
+// Like TotalBodyRecord, each value carries the header column it was read from,
+// with the region, side and metric given by the spec's column mapping
+type SpecRecord struct {
+    ID1          string        `json:"id1"`                    // Primary patient/subject identifier
+    ID2          string        `json:"id2"`                    // Secondary identifier
+    ID3          string        `json:"id3"`                    // Tertiary identifier
+    Date         ScanDate      `json:"date"`                   // Scan date
+    Demographics *Demographics `json:"demographics,omitempty"` // Patient details, when the export has them
+    Values       []SpecValue   `json:"values"`                 // Measurements in header order
+}
+
+// SpecValue is a single measurement of a spec-defined format
+// Every header column produces a value; Value is nil when the cell is missing
+type SpecValue struct {
+    Name   string   `json:"name"`             // Source header text
+    Region string   `json:"region,omitempty"` // Region from the spec or the header
+    Side   string   `json:"side,omitempty"`   // Side from the spec or the header
+    Metric string   `json:"metric,omitempty"` // Measurement type from the spec or the header
+    Key    string   `json:"key"`              // Output column name from the spec, or derived from the header
+    Unit   string   `json:"unit,omitempty"`   // Unit from the cell, header or spec, if given
+    Value  *float64 `json:"value"`            // Measured value, nil when missing
 }
 
 // CoreScanRecord represents a Core Scan (VAT measurement)
 // Measures visceral adipose tissue - the abdominal fat that surrounds internal organs
 // VAT is a key health indicator associated with metabolic syndrome and cardiovascular risk
+// Units are read from the export (typically lbs and in³) rather than assumed
+// A missing value is nil
 type CoreScanRecord struct {
-    ID1       string  `json:"id1"`            // Primary patient/subject identifier
-    ID2       string  `json:"id2"`            // Secondary identifier
-    ID3       string  `json:"id3"`            // Tertiary identifier
-    Date      string  `json:"date"`           // Scan date
-    VATMass   float64 `json:"vat_mass_lbs"`   // Visceral adipose tissue mass in pounds
-    VATVolume float64 `json:"vat_volume_in3"` // Visceral adipose tissue volume in cubic inches
+    ID1           string        `json:"id1"`                       // Primary patient/subject identifier
+    ID2           string        `json:"id2"`                       // Secondary identifier
+    ID3           string        `json:"id3"`                       // Tertiary identifier
+    Date          ScanDate      `json:"date"`                      // Scan date
+    Demographics  *Demographics `json:"demographics,omitempty"`    // Patient details, when the export has them
+    VATMass       *float64      `json:"vat_mass"`                  // Visceral adipose tissue mass
+    VATMassUnit   string        `json:"vat_mass_unit,omitempty"`   // Unit of VATMass (e.g. "lbs", "kg")
+    VATVolume     *float64      `json:"vat_volume"`                // Visceral adipose tissue volume
+    VATVolumeUnit string        `json:"vat_volume_unit,omitempty"` // Unit of VATVolume (e.g. "in³")
 }
@@ -0,0 +1,246 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// FormatSpec is a report type described in a JSON or YAML spec file instead of in code
+// Specs are loaded at startup (see LoadSpecs) and detected after the built-in
+// types; their records are SpecRecords and their CSV columns are the keys of
+// the mapped header columns
+//
+// Example spec:
+//
+//     {
+//       "name": "heel",
+//       "title": "Heel Ultrasound (QUS)",
+//       "detect": ["\\bbua\\b", "stiffness"],
+//       "columns": [
+//         {"match": "^(left|right)? ?bua", "metric": "BUA", "unit": "dB/MHz"},
+//         {"match": "stiffness", "key": "Stiffness_Index", "metric": "Stiffness Index"}
+//       ]
+//     }
+type FormatSpec struct {
+    Name    string       `json:"name"`    // Short name, used in output file names, e.g. "heel"
+    Title   string       `json:"title"`   // Display name, e.g. "Heel Ultrasound (QUS)"
+    Detect  []string     `json:"detect"`  // Regular expressions that must all match the header row
+    Columns []SpecColumn `json:"columns"` // Column mappings; the first one matching a column wins
+
+    file   string           // Spec file the format was loaded from
+    t      DXAType          // Type assigned when the spec was registered
+    detect []*regexp.Regexp // Compiled Detect patterns
+}
+
+// SpecColumn maps the header columns matching a pattern to a measurement
+// Region, Side and Metric replace what the built-in vocabulary decodes from the
+// header name; Key is the output column name (without unit suffix) and is
+// derived from Region, Side and Metric when empty
+type SpecColumn struct {
+    Match  string `json:"match"`  // Regular expression matched against the header name
+    Key    string `json:"key"`    // Output column name, e.g. "Stiffness_Index"
+    Region string `json:"region"` // Body region or site, e.g. "Heel"
+    Side   string `json:"side"`   // "Left", "Right", or "" for the combined value
+    Metric string `json:"metric"` // Measurement type, e.g. "BUA"
+    Unit   string `json:"unit"`   // Unit used when neither the header nor the cell gives one
+
+    match *regexp.Regexp // Compiled Match pattern
+}
+
+// dxaTypeSpecBase is the first DXAType given to a spec-defined format
+const dxaTypeSpecBase DXAType = 100
+
+// formatSpecs are the spec-defined formats, in registration order
+var formatSpecs []*FormatSpec
+
+// specExtensions are the file name extensions of spec files
+var specExtensions = []string{".json", ".yaml", ".yml"}
+
+// LoadSpecs registers every *.json, *.yaml and *.yml spec file in dir, in file
+// name order
+func LoadSpecs(dir string) error {
+    paths := []string{}
+    for _, ext := range specExtensions {
+        matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+        if err != nil {
+            return err
+        }
+        paths = append(paths, matches...)
+    }
+    sort.Strings(paths)
+
+    for _, path := range paths {
+        spec, err := readSpec(path)
+        if err != nil {
+            return fmt.Errorf("spec %s: %w", path, err)
+        }
+        if err := registerSpec(spec); err != nil {
+            return fmt.Errorf("spec %s: %w", path, err)
+        }
+    }
+    return nil
+}
+
+// readSpec reads a spec file; YAML files are decoded by decodeYAML and then
+// read through the same JSON field names
+func readSpec(path string) (*FormatSpec, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+        doc, err := decodeYAML(data)
+        if err != nil {
+            return nil, err
+        }
+        if _, ok := doc.(map[string]interface{}); !ok {
+            return nil, fmt.Errorf("expected a mapping of spec fields")
+        }
+        if data, err = json.Marshal(doc); err != nil {
+            return nil, err
+        }
+    }
+
+    spec := &FormatSpec{file: path}
+    if err := json.Unmarshal(data, spec); err != nil {
+        return nil, err
+    }
+    return spec, nil
+}
+
+// registerSpec validates a spec, compiles its patterns and assigns it a DXAType
+func registerSpec(spec *FormatSpec) error {
+    spec.Name = strings.ToLower(strings.TrimSpace(spec.Name))
+    if spec.Name == "" {
+        return fmt.Errorf("missing name")
+    }
+    for t, key := range dxaTypeKeys {
+        if key == spec.Name {
+            if s := specFor(t); s != nil {
+                return fmt.Errorf("name %q is already defined by %s", spec.Name, s.file)
+            }
+            return fmt.Errorf("name %q is a built-in type", spec.Name)
+        }
+    }
+    if spec.Title == "" {
+        spec.Title = spec.Name
+    }
+
+    // Detection patterns are matched case-insensitively, like the built-in detection
+    if len(spec.Detect) == 0 {
+        return fmt.Errorf("no detect patterns")
+    }
+    for _, p := range spec.Detect {
+        re, err := regexp.Compile("(?i)" + p)
+        if err != nil {
+            return fmt.Errorf("detect pattern %q: %w", p, err)
+        }
+        spec.detect = append(spec.detect, re)
+    }
+
+    for i := range spec.Columns {
+        c := &spec.Columns[i]
+        re, err := regexp.Compile("(?i)" + c.Match)
+        if err != nil {
+            return fmt.Errorf("column pattern %q: %w", c.Match, err)
+        }
+        c.match = re
+        if c.Side != "" {
+            side, ok := sideNames[strings.ToLower(c.Side)]
+            if !ok {
+                return fmt.Errorf("column %q: side must be left, right, mean or delta", c.Match)
+            }
+            c.Side = side
+        }
+        c.Unit = normalizeUnit(c.Unit)
+    }
+
+    spec.t = dxaTypeSpecBase + DXAType(len(formatSpecs))
+    dxaTypeKeys[spec.t] = spec.Name
+    formatSpecs = append(formatSpecs, spec)
+    return nil
+}
+
+// specFor returns the spec that defines t, or nil for built-in types
+func specFor(t DXAType) *FormatSpec {
+    i := int(t - dxaTypeSpecBase)
+    if i < 0 || i >= len(formatSpecs) {
+        return nil
+    }
+    return formatSpecs[i]
+}
+
+// detects reports whether every detect pattern of the spec matches the header
+func (spec *FormatSpec) detects(header string) bool {
+    for _, re := range spec.detect {
+        if !re.MatchString(header) {
+            return false
+        }
+    }
+    return true
+}
+
+// claims reports whether a column mapping of the spec matches a header column
+func (spec *FormatSpec) claims(c Column) bool {
+    for _, m := range spec.Columns {
+        if m.matches(c) {
+            return true
+        }
+    }
+    return false
+}
+
+// key returns the key given to the columns the mapping matches, or "" when
+// they keep their decoded key
+func (m SpecColumn) key() string {
+    switch {
+    case m.Key != "":
+        return sanitizeColumnName(m.Key)
+    case m.Metric != "":
+        return sanitizeColumnName(strings.Join(strings.Fields(m.Region+" "+m.Side+" "+m.Metric), " "))
+    }
+    return ""
+}
+
+// matches reports whether the mapping matches a header column: by its pattern,
+// or by the key it gives, as in this tool's own outputs read back as input
+func (m SpecColumn) matches(c Column) bool {
+    if m.match.MatchString(c.Name) {
+        return true
+    }
+    key := m.key()
+    name := sanitizeColumnName(c.Name)
+    return key != "" && (name == key || name == key+unitSuffix(m.Unit))
+}
+
+// applyColumns gives the header columns matched by the spec their mapped
+// region, side, metric, unit and key. Unmatched columns keep the identity
+// decoded by parseHeader, so they are still converted under a generic label
+func (spec *FormatSpec) applyColumns(cols []Column) {
+    for i := range cols {
+        c := &cols[i]
+        if c.Index < 4 || c.Name == "" || isDemographicKey(c.Key) {
+            continue // ID/date field, blank header cell or patient detail
+        }
+
+        for _, m := range spec.Columns {
+            if !m.matches(*c) {
+                continue
+            }
+            c.Region, c.Side, c.Metric = m.Region, m.Side, m.Metric
+            if c.Unit == "" {
+                c.Unit = m.Unit
+            }
+            if key := m.key(); key != "" {
+                c.Key = key
+            }
+            break
+        }
+    }
+    uniqueKeys(cols)
+}
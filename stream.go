@@ -0,0 +1,329 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+)
+
+// RecordIterator yields parsed records one at a time
+// OutputJSON and OutputCSV consume records through this interface so a
+// RecordReader can be converted without holding the whole file in memory
+type RecordIterator interface {
+    Type() DXAType              // Format of every record produced
+    Columns() []Column          // Header layout, used to build CSV column names
+    Next() (interface{}, error) // Next record, or io.EOF when done
+}
+
+// sliceIterator adapts an in-memory record slice (as returned by ParseFile)
+// to the RecordIterator interface
+type sliceIterator struct {
+    t       DXAType
+    records []interface{}
+    cols    []Column
+    pos     int
+}
+
+// iterateRecords wraps a slice of BodyFatRecord, TotalBodyRecord, CoreScanRecord,
+// SpineRecord, FemurRecord, ForearmRecord or SpecRecord
+// The column layout is rebuilt from the records themselves (union of all
+// measurements, in first-seen order), so records merged from several files
+// still line up
+func iterateRecords(t DXAType, records interface{}) RecordIterator {
+    it := &sliceIterator{t: t}
+
+    switch r := records.(type) {
+    case []BodyFatRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, m := range append(rec.Mass, rec.Percent...) {
+                label := measurementLabel(m)
+                if seen[label] {
+                    continue
+                }
+                seen[label] = true
+                for _, side := range []string{"", "Left", "Right", "Delta"} {
+                    it.cols = append(it.cols, Column{Region: m.Region, Metric: m.Metric, Side: side})
+                }
+            }
+            if rec.Hydration != nil && !seen["hydration"] {
+                seen["hydration"] = true
+                for _, key := range hydrationKeys {
+                    it.cols = append(it.cols, Column{Key: key})
+                }
+            }
+        }
+    case []TotalBodyRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, v := range rec.Values {
+                if seen[v.Key] {
+                    continue
+                }
+                seen[v.Key] = true
+                it.cols = append(it.cols, Column{Name: v.Name, Unit: v.Unit, Key: v.Key})
+            }
+        }
+    case []CoreScanRecord:
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+        }
+    case []SpineRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, v := range rec.Values {
+                if seen[v.Key] {
+                    continue
+                }
+                seen[v.Key] = true
+                it.cols = append(it.cols, Column{Name: v.Name, Region: v.Region, Metric: v.Metric, Unit: v.Unit, Key: v.Key})
+            }
+        }
+    case []ForearmRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, v := range rec.Values {
+                if seen[v.Key] {
+                    continue
+                }
+                seen[v.Key] = true
+                it.cols = append(it.cols, Column{Name: v.Name, Region: v.Region, Side: v.Side, Metric: v.Metric, Unit: v.Unit, Key: v.Key})
+            }
+        }
+    case []SpecRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, v := range rec.Values {
+                if seen[v.Key] {
+                    continue
+                }
+                seen[v.Key] = true
+                it.cols = append(it.cols, Column{Name: v.Name, Region: v.Region, Side: v.Side, Metric: v.Metric, Unit: v.Unit, Key: v.Key})
+            }
+        }
+    case []FemurRecord:
+        seen := map[string]bool{}
+        for _, rec := range r {
+            it.records = append(it.records, rec)
+            for _, m := range rec.Sites {
+                label := femurLabel(m)
+                if seen[label] {
+                    continue
+                }
+                seen[label] = true
+                for _, side := range []string{"Left", "Right", "Mean"} {
+                    it.cols = append(it.cols, Column{Region: m.Site, Metric: m.Metric, Side: side})
+                }
+            }
+        }
+    }
+
+    // Patient detail columns come first, as in the exports, when any record has them
+    for _, rec := range it.records {
+        if recordDemographics(rec) != nil {
+            demo := []Column{}
+            for _, key := range demographicKeys {
+                demo = append(demo, Column{Name: key, Key: key})
+            }
+            it.cols = append(demo, it.cols...)
+            break
+        }
+    }
+
+    return it
+}
+
+// Type returns the format of the wrapped records
+func (it *sliceIterator) Type() DXAType {
+    return it.t
+}
+
+// Columns returns the layout rebuilt from the records
+func (it *sliceIterator) Columns() []Column {
+    return it.cols
+}
+
+// Next returns the next record of the slice, or io.EOF when done
+func (it *sliceIterator) Next() (interface{}, error) {
+    if it.pos >= len(it.records) {
+        return nil, io.EOF
+    }
+    rec := it.records[it.pos]
+    it.pos++
+    return rec, nil
+}
+
+// countingIterator passes records through while counting them
+type countingIterator struct {
+    RecordIterator
+    count int
+}
+
+// Next returns the next record of the wrapped iterator and counts it
+func (c *countingIterator) Next() (interface{}, error) {
+    rec, err := c.RecordIterator.Next()
+    if err == nil {
+        c.count++
+    }
+    return rec, err
+}
+
+// dateFormatIterator sets the output layout of every record's scan date and
+// birth date (see resolveDateFormat) as the records pass through
+type dateFormatIterator struct {
+    RecordIterator
+    layout string
+}
+
+// Next returns the next record of the wrapped iterator with its date layout set
+func (d *dateFormatIterator) Next() (interface{}, error) {
+    rec, err := d.RecordIterator.Next()
+    switch r := rec.(type) {
+    case BodyFatRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case TotalBodyRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case CoreScanRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case SpineRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case FemurRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case ForearmRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    case SpecRecord:
+        r.Date = r.Date.withDateFormat(d.layout)
+        r.Demographics = r.Demographics.withDateFormat(d.layout)
+        return r, err
+    }
+    return rec, err
+}
+
+// withDateFormat returns a copy of the demographics whose birth date formats
+// with the given layout; nil stays nil
+func (d *Demographics) withDateFormat(layout string) *Demographics {
+    if d == nil {
+        return nil
+    }
+    c := *d
+    c.BirthDate = c.BirthDate.withDateFormat(layout)
+    return &c
+}
+
+// sectionChain continues into the following sections of a RecordReader once
+// the current one is exhausted, so every record of a multi-section file can be
+// written to a single output
+type sectionChain struct {
+    RecordIterator               // Records of the current section (possibly wrapped)
+    reader         *RecordReader // Reader whose sections are chained
+}
+
+// Next returns the next record of the current or a following section, tagged
+// with its section
+func (c *sectionChain) Next() (interface{}, error) {
+    for {
+        rec, err := c.RecordIterator.Next()
+        if err == nil {
+            return sectionRecord{Type: dxaTypeKeys[c.reader.Type()], Section: c.reader.Section(), Record: rec}, nil
+        }
+        if err != io.EOF {
+            return rec, err
+        }
+        more, err := c.reader.NextSection()
+        if err != nil {
+            return nil, err
+        }
+        if !more {
+            return nil, io.EOF
+        }
+    }
+}
+
+// iteratorChain yields the records of several iterators one after the other,
+// so sections held in memory can be written to a single JSON output; each
+// iterator is a section
+type iteratorChain struct {
+    its     []RecordIterator
+    section int // Number of the current iterator's section, less 1
+}
+
+// Type returns the format of the current iterator
+func (c *iteratorChain) Type() DXAType {
+    if len(c.its) == 0 {
+        return DXATypeUnknown
+    }
+    return c.its[0].Type()
+}
+
+// Columns returns the layout of the current iterator
+func (c *iteratorChain) Columns() []Column {
+    if len(c.its) == 0 {
+        return nil
+    }
+    return c.its[0].Columns()
+}
+
+// Next returns the next record of the current or a following iterator, tagged
+// with its section
+func (c *iteratorChain) Next() (interface{}, error) {
+    for len(c.its) > 0 {
+        rec, err := c.its[0].Next()
+        if err == nil {
+            return sectionRecord{Type: dxaTypeKeys[c.its[0].Type()], Section: c.section + 1, Record: rec}, nil
+        }
+        if err != io.EOF {
+            return rec, err
+        }
+        c.its = c.its[1:]
+        c.section++
+    }
+    return nil, io.EOF
+}
+
+// sectionRecord is a record of a combined JSON output, which holds the records
+// of every section of the input: its format and section are written ahead of
+// the record's own fields, e.g. {"type": "corescan", "section": 2, "id1": ...}
+type sectionRecord struct {
+    Type    string      // Format key of the section, e.g. "bodycomp"
+    Section int         // Number of the section in the output (1-based)
+    Record  interface{} // Record as returned by RecordReader.Next
+}
+
+// MarshalJSON writes the section tags followed by the fields of the record
+func (s sectionRecord) MarshalJSON() ([]byte, error) {
+    tags, err := json.Marshal(struct {
+        Type    string `json:"type"`
+        Section int    `json:"section"`
+    }{s.Type, s.Section})
+    if err != nil {
+        return nil, err
+    }
+    data, err := json.Marshal(s.Record)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) < 2 || data[0] != '{' {
+        return nil, fmt.Errorf("section %d: record is not a JSON object", s.Section)
+    }
+    if len(data) == 2 {
+        return tags, nil // Empty object
+    }
+    return append(append(tags[:len(tags)-1], ','), data[1:]...), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+// combinedJSON converts an input to a single JSON output, as main does
+func combinedJSON(t *testing.T, input string) []map[string]interface{} {
+    t.Helper()
+    rr, err := NewRecordReader(strings.NewReader(input), ParseOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var out bytes.Buffer
+    if err := OutputJSON(&out, &sectionChain{RecordIterator: rr, reader: rr}); err != nil {
+        t.Fatal(err)
+    }
+    records := []map[string]interface{}{}
+    if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+        t.Fatalf("%v\n%s", err, out.String())
+    }
+    return records
+}
+
+func TestSectionChainTags(t *testing.T) {
+    input := strings.Join([]string{
+        "Last Name\tFirst Name\tPatient ID\tMeasure Date\tArms Fat Mass (lbs)\tArms Fat Mass Left (lbs)",
+        "Doe\tJane\tP001\t11/11/2025\t1.5\t0.7",
+        "",
+        "Last Name\tFirst Name\tPatient ID\tMeasure Date\tVAT Mass (lbs)\tVAT Volume (in3)",
+        "Doe\tJane\tP001\t11/11/2025\t1.23\t45.6",
+        "",
+        "Last Name\tFirst Name\tPatient ID\tMeasure Date\tVAT Mass (kg)\tVAT Volume (cm3)",
+        "Roe\tJohn\tP002\t11/12/2025\t0.5\t700",
+    }, "\n")
+
+    want := []struct {
+        typ     string
+        section float64
+        id3     string
+    }{
+        {"bodycomp", 1, "P001"},
+        {"corescan", 2, "P001"},
+        {"corescan", 3, "P002"},
+    }
+
+    // The tags survive reading the output back, which keeps the sections apart
+    first := combinedJSON(t, input)
+    data, _ := json.Marshal(first)
+    for _, records := range [][]map[string]interface{}{first, combinedJSON(t, string(data))} {
+        if len(records) != len(want) {
+            t.Fatalf("got %d records, want %d", len(records), len(want))
+        }
+        for i, w := range want {
+            r := records[i]
+            if r["type"] != w.typ || r["section"] != w.section || r["id3"] != w.id3 {
+                t.Errorf("record %d: type %v, section %v, id3 %v, want %s, %v, %s", i+1, r["type"], r["section"], r["id3"], w.typ, w.section, w.id3)
+            }
+        }
+    }
+}
+
+func TestSectionRecordJSON(t *testing.T) {
+    tests := []struct {
+        rec  interface{}
+        want string
+    }{
+        {struct {
+            ID1 string `json:"id1"`
+        }{"a"}, `{"type":"corescan","section":2,"id1":"a"}`},
+        {struct{}{}, `{"type":"corescan","section":2}`},
+    }
+
+    for _, tt := range tests {
+        data, err := json.Marshal(sectionRecord{Type: "corescan", Section: 2, Record: tt.rec})
+        if err != nil || string(data) != tt.want {
+            t.Errorf("json.Marshal(%+v) = %s, %v, want %s", tt.rec, data, err, tt.want)
+        }
+    }
+    if _, err := json.Marshal(sectionRecord{Type: "corescan", Section: 2, Record: 1.5}); err == nil {
+        t.Errorf("json.Marshal of a number record succeeded, want an error")
+    }
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// VendorProfile describes the export conventions of one scanner manufacturer
+// Profiles translate a vendor's header into the common vocabulary used by
+// detectDXAType and parseHeader ("Arms Fat Mass Left", "Neck BMD", ...), so
+// exports from every vendor produce the same normalized records
+type VendorProfile struct {
+    Vendor   string // Manufacturer, e.g. "GE Lunar", "Hologic"; "" when unknown
+    Software string // Software family, e.g. "enCORE", "APEX"
+    Version  string // Software version, when the export states it
+
+    key        string                        // Name accepted by --vendor
+    banner     *regexp.Regexp                // Matches a line above the header naming the software, if any
+    markers    []string                      // Lowercase header substrings that identify the vendor
+    idColumns  [4][]string                   // Lowercase header names of ID1, ID2, ID3 and Date
+    vocabulary func(name, ctx string) string // Rewrites a column name in the common vocabulary
+    units      map[string]string             // Default unit per metric when the header gives none
+}
+
+// vendorProfiles are the known manufacturers, tried in order
+var vendorProfiles = []VendorProfile{
+    {
+        // This tool's own CSV output (see outputColumnName), tried first as its
+        // ID column names are also Hologic's
+        Vendor:   "dxafile",
+        Software: "output",
+        key:      "dxafile",
+        markers:  []string{"measure_date"},
+        idColumns: [4][]string{
+            {"last_name"},
+            {"first_name"},
+            {"patient_id"},
+            {"measure_date"},
+        },
+        vocabulary: func(name, _ string) string { return outputColumnName(name) },
+    },
+    {
+        Vendor:   "Hologic",
+        Software: "APEX",
+        key:      "hologic",
+        banner:   regexp.MustCompile(`(?i)\b(hologic|apex)\b`),
+        markers:  []string{"scan_date", "wbtot_", "subtot_", "neck_bmd", "troch_bmd", "l1_bmd", "vfat_", "_pfat"},
+        idColumns: [4][]string{
+            {"last_name", "lastname"},
+            {"first_name", "firstname"},
+            {"patient_id", "pat_id", "patient_key"},
+            {"scan_date", "scandate", "acq_date"},
+        },
+        vocabulary: hologicColumnName,
+        units: map[string]string{
+            "Fat Mass":   "g",
+            "Lean Mass":  "g",
+            "Bone Mass":  "g",
+            "Total Mass": "g",
+            "BMC":        "g",
+            "VAT Mass":   "g",
+            "BMD":        "g/cm²",
+            "Area":       "cm²",
+            "VAT Area":   "cm²",
+            "VAT Volume": "cm³",
+        },
+    },
+    {
+        Vendor:   "GE Lunar",
+        Software: "enCORE",
+        key:      "ge",
+        banner:   regexp.MustCompile(`(?i)\b(ge healthcare|lunar|encore)\b`),
+        markers:  []string{"measure date", "arms fat mass", "head bmd", "vat mass"},
+        idColumns: [4][]string{
+            {"last name"},
+            {"first name"},
+            {"patient id"},
+            {"measure date", "scan date"},
+        },
+    },
+}
+
+// vendorKeys lists the values accepted by --vendor
+var vendorKeys = []string{"auto", "ge", "hologic", "dxafile"}
+
+// versionRE matches a dotted software version such as "5.6.0.5" or "16.0"
+var versionRE = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// String returns the vendor and software for display, e.g. "Hologic APEX 5.6.0.5"
+func (p VendorProfile) String() string {
+    if p.Vendor == "" {
+        return "Unknown"
+    }
+    return strings.Join(strings.Fields(p.Vendor+" "+p.Software+" "+p.Version), " ")
+}
+
+// lookupVendor returns the profile named by a --vendor value
+// "auto" and "" return false so the vendor is identified from the file
+func lookupVendor(name string) (VendorProfile, bool, error) {
+    name = strings.ToLower(strings.TrimSpace(name))
+    if name == "" || name == "auto" {
+        return VendorProfile{}, false, nil
+    }
+    for _, p := range vendorProfiles {
+        if p.key == name {
+            return p, true, nil
+        }
+    }
+    return VendorProfile{}, false, fmt.Errorf("invalid vendor %q: use %s", name, strings.Join(vendorKeys, ", "))
+}
+
+// vendorBanner identifies the vendor from a line above the header, such as
+// "Hologic APEX Version 5.6.0.5" or "GE Healthcare enCORE 16.0"
+// The version is the first dotted number on the line
+func vendorBanner(line string) (VendorProfile, bool) {
+    for _, p := range vendorProfiles {
+        if p.banner != nil && p.banner.MatchString(line) {
+            p.Version = versionRE.FindString(line)
+            return p, true
+        }
+    }
+    return VendorProfile{}, false
+}
+
+// identifyVendor identifies the vendor from the vocabulary of the header row
+// Returns the zero profile (no translation) when no vendor matches
+func identifyVendor(header string) VendorProfile {
+    h := strings.ToLower(header)
+    for _, p := range vendorProfiles {
+        for _, m := range p.markers {
+            if strings.Contains(h, m) {
+                return p
+            }
+        }
+    }
+    return VendorProfile{}
+}
+
+// normalizeHeader rewrites a header row in the common layout and vocabulary
+// The ID and date columns are moved to the first four positions when the
+// vendor puts them elsewhere; order lists the source position of each output
+// column, or is nil when the columns stay in place. Data rows are rearranged
+// with reorderFields
+func (p VendorProfile) normalizeHeader(header string) (string, []int) {
+    fields := strings.Split(header, "\t")
+    order := p.columnOrder(fields)
+    if order != nil {
+        fields = reorderFields(fields, order)
+    }
+
+    // Translate the measurement columns, adding the vendor's default unit
+    ctx := p.headerContext(fields)
+    for i := 4; i < len(fields); i++ {
+        name := strings.TrimSpace(fields[i])
+        if name == "" {
+            continue
+        }
+        if p.vocabulary != nil {
+            name = p.vocabulary(name, ctx)
+        }
+        if headerUnit(name) == "" {
+            _, metric, _ := decodeColumnName(name)
+            if unit := p.units[metric]; unit != "" {
+                name += " (" + unit + ")"
+            }
+        }
+        fields[i] = name
+    }
+    return strings.Join(fields, "\t"), order
+}
+
+// columnOrder returns the rearrangement that puts the vendor's ID and date
+// columns first, or nil when they are already first or cannot all be found
+func (p VendorProfile) columnOrder(fields []string) []int {
+    ids := [4]int{-1, -1, -1, -1}
+    for i, f := range fields {
+        name := strings.ToLower(strings.TrimSpace(f))
+        for j, names := range p.idColumns {
+            for _, n := range names {
+                if name == n && ids[j] < 0 {
+                    ids[j] = i
+                }
+            }
+        }
+    }
+
+    inPlace := true
+    for j, i := range ids {
+        if i < 0 {
+            return nil // Fall back to the positional layout
+        }
+        inPlace = inPlace && i == j
+    }
+    if inPlace {
+        return nil
+    }
+
+    order := append([]int{}, ids[:]...)
+    for i := range fields {
+        if i != ids[0] && i != ids[1] && i != ids[2] && i != ids[3] {
+            order = append(order, i)
+        }
+    }
+    return order
+}
+
+// isDateColumn reports whether name is one of the vendor's date column names
+func (p VendorProfile) isDateColumn(name string) bool {
+    for _, n := range p.idColumns[3] {
+        if strings.EqualFold(name, n) {
+            return true
+        }
+    }
+    return false
+}
+
+// headerContext tells the vocabulary which kind of report a header belongs to,
+// for codes whose meaning depends on it (Hologic "BMC" is Bone Mass in a body
+// composition report, "TOT" is L1-L4 in a spine report)
+// Returns "bodycomp", "spine" or ""
+func (p VendorProfile) headerContext(fields []string) string {
+    h := strings.ToLower(strings.Join(fields, "\t"))
+    switch {
+    case strings.Contains(h, "_fat") || strings.Contains(h, "fat mass"):
+        return "bodycomp"
+    case strings.Contains(h, "l1_bmd") || strings.Contains(h, "l2_bmd"):
+        return "spine"
+    }
+    return ""
+}
+
+// reorderFields returns fields rearranged by order (see normalizeHeader)
+// Positions missing from a short row become empty cells
+func reorderFields(fields []string, order []int) []string {
+    out := make([]string, len(order))
+    for i, src := range order {
+        if src < len(fields) {
+            out[i] = fields[src]
+        }
+    }
+    // Keep any cells beyond the header so field-count checks still see them
+    if len(fields) > len(order) {
+        out = append(out, fields[len(order):]...)
+    }
+    return out
+}
+
+// hologicRegions maps Hologic APEX region codes to the common region words
+var hologicRegions = map[string]string{
+    "ARM":     "Arms",
+    "LEG":     "Legs",
+    "TRUNK":   "Trunk",
+    "HEAD":    "Head",
+    "WBTOT":   "Total",
+    "SUBTOT":  "TBLH",
+    "ANDROID": "Android",
+    "GYNOID":  "Gynoid",
+    "PELV":    "Pelvis",
+    "SPINE":   "Spine",
+    "RIB":     "Ribs",
+    "NECK":    "Neck",
+    "TROCH":   "Troch",
+    "INTER":   "Inter",
+    "WARDS":   "Ward's",
+    "HTOT":    "Total Hip",
+    "TOT":     "Total",
+    "UD":      "UD",
+    "MID":     "Mid",
+    "33":      "33%",
+}
+
+// hologicForearmBones maps the bone prefix of Hologic forearm codes (R_UD_BMD)
+var hologicForearmBones = map[string]string{
+    "R":  "Radius",
+    "U":  "Ulna",
+    "RU": "Radius Ulna",
+}
+
+// hologicForearmSites are the site codes after which R, U and RU name a bone
+var hologicForearmSites = map[string]bool{"UD": true, "MID": true, "33": true, "TOT": true}
+
+// hologicMetrics maps Hologic APEX metric codes to the common metric words
+var hologicMetrics = map[string]string{
+    "FAT":    "Fat Mass",
+    "LEAN":   "Lean Mass",
+    "MASS":   "Total Mass",
+    "PFAT":   "Region %Fat",
+    "BMC":    "BMC",
+    "BMD":    "BMD",
+    "AREA":   "Area",
+    "T":      "T-Score",
+    "TSCORE": "T-Score",
+    "Z":      "Z-Score",
+    "ZSCORE": "Z-Score",
+    "VOLUME": "Volume",
+}
+
+// hologicColumnName translates a Hologic APEX column code into the common
+// vocabulary, e.g. "L_ARM_FAT" -> "Arms Fat Mass Left", "NECK_BMD" -> "Neck BMD",
+// "R_UD_BMD" -> "Radius UD BMD", "VFAT_MASS" -> "VAT Mass"
+// Names that are not Hologic codes are returned unchanged
+func hologicColumnName(name, ctx string) string {
+    code := strings.ToUpper(stripParenthetical(name))
+    tokens := strings.FieldsFunc(code, func(r rune) bool { return r == '_' }) // "TROCH__BMD" reads as TROCH_BMD
+    if len(tokens) < 2 || strings.Contains(code, " ") {
+        return name
+    }
+
+    metric, ok := hologicMetrics[tokens[len(tokens)-1]]
+    if !ok {
+        return name
+    }
+    tokens = tokens[:len(tokens)-1]
+
+    // A leading L/R is the side, except before a forearm site where R/U/RU is the bone
+    side, bone := "", ""
+    if len(tokens) > 1 {
+        if b, ok := hologicForearmBones[tokens[0]]; ok && hologicForearmSites[tokens[1]] {
+            bone, tokens = b, tokens[1:]
+        }
+    }
+    if bone == "" && len(tokens) > 1 {
+        switch tokens[0] {
+        case "L":
+            side, tokens = "Left", tokens[1:]
+        case "R":
+            side, tokens = "Right", tokens[1:]
+        }
+    }
+
+    region := []string{}
+    for _, t := range tokens {
+        switch {
+        case t == "VFAT":
+            // Visceral fat: VFAT_MASS -> VAT Mass, VFAT_VOLUME -> VAT Volume
+            metric = "VAT " + strings.TrimPrefix(metric, "Total ")
+        case t == "TOT" && ctx == "spine":
+            region = append(region, "L1-L4")
+        case (t == "ARM" || t == "LEG") && ctx != "bodycomp":
+            // Total Body names a single limb: "Arm Left BMD"
+            region = append(region, strings.TrimSuffix(hologicRegions[t], "s"))
+        case hologicRegions[t] != "":
+            region = append(region, hologicRegions[t])
+        default:
+            region = append(region, strings.ToUpper(t[:1])+strings.ToLower(t[1:]))
+        }
+    }
+
+    if metric == "BMC" && ctx == "bodycomp" {
+        metric = "Bone Mass"
+    }
+
+    out := strings.Join(strings.Fields(bone+" "+strings.Join(region, " ")+" "+metric+" "+side), " ")
+    if unit := headerUnit(name); unit != "" {
+        out += " (" + unit + ")"
+    }
+    return out
+}
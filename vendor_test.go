@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestHologicColumnName(t *testing.T) {
+    tests := []struct {
+        name string
+        ctx  string
+        want string
+    }{
+        // Regions, sides and metrics
+        {"L_ARM_FAT", "bodycomp", "Arms Fat Mass Left"},
+        {"R_LEG_LEAN", "bodycomp", "Legs Lean Mass Right"},
+        {"subtot_lean", "bodycomp", "TBLH Lean Mass"},
+        {"WBTOT_PFAT", "bodycomp", "Total Region %Fat"},
+        {"NECK_BMD", "", "Neck BMD"},
+        {"NECK_T", "", "Neck T-Score"},
+        {"HTOT_ZSCORE", "", "Total Hip Z-Score"},
+        {"R_NECK_BMD", "", "Neck BMD Right"},
+        {"L1_BMD", "spine", "L1 BMD"},
+
+        // Codes whose meaning depends on the report
+        {"WBTOT_BMC", "bodycomp", "Total Bone Mass"},
+        {"WBTOT_BMC", "", "Total BMC"},
+        {"TOT_BMD", "spine", "L1-L4 BMD"},
+        {"TOT_BMD", "", "Total BMD"},
+        {"L_ARM_BMD", "", "Arm BMD Left"},
+
+        // Forearm bones
+        {"R_UD_BMD", "", "Radius UD BMD"},
+        {"U_MID_BMD", "", "Ulna Mid BMD"},
+        {"RU_33_BMD", "", "Radius Ulna 33% BMD"},
+        {"RU_TOT_AREA", "", "Radius Ulna Total Area"},
+
+        // Visceral fat
+        {"VFAT_MASS", "bodycomp", "VAT Mass"},
+        {"VFAT_VOLUME", "", "VAT Volume"},
+        {"VFAT_AREA", "", "VAT Area"},
+        {"VFAT_MASS (lbs)", "bodycomp", "VAT Mass (lbs)"},
+
+        // Not Hologic codes
+        {"BMD", "", "BMD"},
+        {"NECK_WIDTH", "", "NECK_WIDTH"},
+        {"Arms Fat Mass", "bodycomp", "Arms Fat Mass"},
+        {"Scan_Date", "", "Scan_Date"},
+
+        // Empty tokens
+        {"TROCH__BMD", "", "Troch BMD"},
+        {"_NECK_BMD_", "", "Neck BMD"},
+        {"_BMD", "", "_BMD"},
+        {"BMD_", "", "BMD_"},
+        {"__", "", "__"},
+    }
+
+    for _, tt := range tests {
+        if got := hologicColumnName(tt.name, tt.ctx); got != tt.want {
+            t.Errorf("hologicColumnName(%q, %q) = %q, want %q", tt.name, tt.ctx, got, tt.want)
+        }
+    }
+}
+
+func TestIdentifyVendor(t *testing.T) {
+    tests := []struct {
+        header string
+        want   string // Vendor, "" when unknown
+    }{
+        {"Last_Name\tFirst_Name\tPatient_ID\tMeasure_Date\tVAT_Mass_lbs", "dxafile"},
+        {"Last_Name\tFirst_Name\tPatient_ID\tMeasure_Date\tNeck_BMD", "dxafile"}, // Own output first
+        {"PAT_ID\tSCAN_DATE\tNECK_BMD\tTROCH_BMD", "Hologic"},
+        {"Last_Name\tFirst_Name\tPatient_ID\tAcq_Date\twbtot_fat", "Hologic"},
+        {"Patient ID\tDate\tL1_BMD\tL2_BMD", "Hologic"},
+        {"Last Name\tFirst Name\tPatient ID\tMeasure Date\tArms Fat Mass", "GE Lunar"},
+        {"Name\tID\tDate\tHead BMD", "GE Lunar"},
+        {"Name\tID\tDate\tBMD", ""},
+        {"", ""},
+    }
+
+    for _, tt := range tests {
+        if got := identifyVendor(tt.header).Vendor; got != tt.want {
+            t.Errorf("identifyVendor(%q) = %q, want %q", tt.header, got, tt.want)
+        }
+    }
+}
+
+func TestVendorBanner(t *testing.T) {
+    tests := []struct {
+        line string
+        want string // String() of the profile, "" when the line isn't a banner
+    }{
+        {"Hologic APEX Version 5.6.0.5", "Hologic APEX 5.6.0.5"},
+        {"APEX 4.0", "Hologic APEX 4.0"},
+        {"GE Healthcare enCORE 16.0", "GE Lunar enCORE 16.0"},
+        {"Lunar Prodigy", "GE Lunar enCORE"},
+        {"Report generated 2025-03-14", ""},
+    }
+
+    for _, tt := range tests {
+        p, ok := vendorBanner(tt.line)
+        got := ""
+        if ok {
+            got = p.String()
+        }
+        if got != tt.want {
+            t.Errorf("vendorBanner(%q) = %q, want %q", tt.line, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+    "archive/zip"
+    "bufio"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "math"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Exports opened and re-saved in a spreadsheet arrive as XLSX workbooks: a zip
+// of XML parts (ECMA-376). ReadXLSXSheet turns one worksheet back into the
+// tab-delimited text of a scanner export, so it goes through the same header
+// detection and row parsing as any other input. Only the standard library is
+// used; no office software is needed
+
+// zipMagic starts every zip file, including XLSX workbooks
+const zipMagic = "PK\x03\x04"
+
+// looksLikeZip reports whether the input starts with a zip local file header
+// Nothing is consumed
+func looksLikeZip(br *bufio.Reader) bool {
+    b, err := br.Peek(len(zipMagic))
+    return err == nil && string(b) == zipMagic
+}
+
+// xlsxWorkbook is xl/workbook.xml: the sheets in tab order and the date system
+type xlsxWorkbook struct {
+    Props struct {
+        Date1904 bool `xml:"date1904,attr"`
+    } `xml:"workbookPr"`
+    Sheets []struct {
+        Name string `xml:"name,attr"`
+        RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+    } `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships is a .rels part, mapping relationship ids to part paths
+type xlsxRelationships struct {
+    Relationships []struct {
+        ID     string `xml:"Id,attr"`
+        Target string `xml:"Target,attr"`
+    } `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string: plain text or rich text runs
+// Phonetic runs (rPh) are not part of the value
+type xlsxText struct {
+    T    string `xml:"t"`
+    Runs []struct {
+        T string `xml:"t"`
+    } `xml:"r"`
+}
+
+// String returns the text of the string, runs joined
+func (x xlsxText) String() string {
+    s := x.T
+    for _, r := range x.Runs {
+        s += r.T
+    }
+    return s
+}
+
+// xlsxSharedStrings is xl/sharedStrings.xml
+type xlsxSharedStrings struct {
+    Items []xlsxText `xml:"si"`
+}
+
+// xlsxStyles is the part of xl/styles.xml needed to tell dates from numbers:
+// the number format of each cell style
+type xlsxStyles struct {
+    NumFmts []struct {
+        ID   int    `xml:"numFmtId,attr"`
+        Code string `xml:"formatCode,attr"`
+    } `xml:"numFmts>numFmt"`
+    CellXfs []struct {
+        NumFmtID int `xml:"numFmtId,attr"`
+    } `xml:"cellXfs>xf"`
+}
+
+// xlsxCell is one <c> element of a worksheet row
+type xlsxCell struct {
+    Ref    string   `xml:"r,attr"` // "B3"; may be left out for consecutive cells
+    Type   string   `xml:"t,attr"` // s, inlineStr, str, b, e, d or n (default)
+    Style  int      `xml:"s,attr"` // Index into cellXfs
+    Value  string   `xml:"v"`
+    Inline xlsxText `xml:"is"`
+}
+
+// xlsxRow is one <row> element of a worksheet
+type xlsxRow struct {
+    Num   int        `xml:"r,attr"` // 1-based; may be left out for consecutive rows
+    Cells []xlsxCell `xml:"c"`
+}
+
+// xlsxSheetReader holds what is needed to render the cells of a workbook
+type xlsxSheetReader struct {
+    strings  []string     // Shared strings
+    dates    map[int]bool // Cell styles with a date or time number format
+    date1904 bool         // Serial dates count from 1904 (old Mac workbooks)
+}
+
+// ReadXLSXSheet returns the rows of a worksheet of an XLSX workbook as
+// tab-delimited text that ParseFile and NewRecordReader accept, and the name
+// of the sheet read. sheet names the worksheet (case-insensitive); "" reads the
+// first one. Text row numbers match the sheet's row numbers, so diagnostics
+// point at the spreadsheet row
+// Cells formatted as dates are written as ISO dates (2006-01-02, with a time of
+// day when there is one); numbers are written as stored, not as displayed, so
+// they always have a decimal point
+// The sheet text is built in memory
+func ReadXLSXSheet(r io.ReaderAt, size int64, sheet string) (io.Reader, string, error) {
+    zr, err := zip.NewReader(r, size)
+    if err != nil {
+        return nil, "", fmt.Errorf("reading XLSX workbook: %w", err)
+    }
+    parts := map[string]*zip.File{}
+    for _, f := range zr.File {
+        parts[strings.TrimPrefix(f.Name, "/")] = f
+    }
+    if parts["xl/workbook.xml"] == nil {
+        return nil, "", fmt.Errorf("not an XLSX workbook: xl/workbook.xml is missing")
+    }
+
+    wb := xlsxWorkbook{}
+    if err := readXLSXPart(parts, "xl/workbook.xml", &wb); err != nil {
+        return nil, "", err
+    }
+    rels := xlsxRelationships{}
+    if err := readXLSXPart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+        return nil, "", err
+    }
+
+    // Pick the sheet and find its part through the workbook relationships
+    if len(wb.Sheets) == 0 {
+        return nil, "", fmt.Errorf("XLSX workbook has no sheets")
+    }
+    pick := -1
+    names := []string{}
+    for i, s := range wb.Sheets {
+        names = append(names, strconv.Quote(s.Name))
+        if (sheet == "" && pick < 0) || strings.EqualFold(strings.TrimSpace(sheet), s.Name) {
+            pick = i
+        }
+    }
+    if pick < 0 {
+        return nil, "", fmt.Errorf("XLSX workbook has no sheet %q (sheets: %s)", sheet, strings.Join(names, ", "))
+    }
+    target := ""
+    for _, rel := range rels.Relationships {
+        if rel.ID == wb.Sheets[pick].RID {
+            target = rel.Target
+        }
+    }
+    if target == "" {
+        return nil, "", fmt.Errorf("XLSX workbook: sheet %q has no part", wb.Sheets[pick].Name)
+    }
+    if strings.HasPrefix(target, "/") {
+        target = strings.TrimPrefix(target, "/")
+    } else {
+        target = path.Join("xl", target)
+    }
+
+    // Shared strings and styles are optional parts
+    sr := xlsxSheetReader{dates: map[int]bool{}, date1904: wb.Props.Date1904}
+    if parts["xl/sharedStrings.xml"] != nil {
+        shared := xlsxSharedStrings{}
+        if err := readXLSXPart(parts, "xl/sharedStrings.xml", &shared); err != nil {
+            return nil, "", err
+        }
+        for _, s := range shared.Items {
+            sr.strings = append(sr.strings, s.String())
+        }
+    }
+    if parts["xl/styles.xml"] != nil {
+        styles := xlsxStyles{}
+        if err := readXLSXPart(parts, "xl/styles.xml", &styles); err != nil {
+            return nil, "", err
+        }
+        custom := map[int]string{}
+        for _, f := range styles.NumFmts {
+            custom[f.ID] = f.Code
+        }
+        for i, xf := range styles.CellXfs {
+            if code, ok := custom[xf.NumFmtID]; ok {
+                sr.dates[i] = isDateFormat(code)
+            } else {
+                sr.dates[i] = isBuiltinDateFormat(xf.NumFmtID)
+            }
+        }
+    }
+
+    text, err := sr.sheetText(parts, target)
+    if err != nil {
+        return nil, "", fmt.Errorf("reading XLSX sheet %q: %w", wb.Sheets[pick].Name, err)
+    }
+    return worksheetText{strings.NewReader(text)}, wb.Sheets[pick].Name, nil
+}
+
+// worksheetText is the text of a worksheet. Its numbers are written as stored, with
+// a decimal point and no thousands separators, so NewRecordReader neither
+// detects nor rewrites the decimal separator of its rows
+type worksheetText struct {
+    io.Reader
+}
+
+// readXLSXPart decodes an XML part of the workbook into v
+func readXLSXPart(parts map[string]*zip.File, name string, v interface{}) error {
+    f := parts[name]
+    if f == nil {
+        return fmt.Errorf("XLSX workbook: %s is missing", name)
+    }
+    rc, err := f.Open()
+    if err != nil {
+        return fmt.Errorf("XLSX workbook: %s: %w", name, err)
+    }
+    defer rc.Close()
+    if err := xml.NewDecoder(rc).Decode(v); err != nil {
+        return fmt.Errorf("XLSX workbook: %s: %w", name, err)
+    }
+    return nil
+}
+
+// sheetText renders the rows of a worksheet part as tab-delimited lines
+// Rows are streamed from the XML one at a time; skipped rows become empty lines
+func (sr *xlsxSheetReader) sheetText(parts map[string]*zip.File, name string) (string, error) {
+    f := parts[name]
+    if f == nil {
+        return "", fmt.Errorf("%s is missing", name)
+    }
+    rc, err := f.Open()
+    if err != nil {
+        return "", err
+    }
+    defer rc.Close()
+
+    var text strings.Builder
+    dec := xml.NewDecoder(rc)
+    line := 0
+    for {
+        tok, err := dec.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", err
+        }
+        start, ok := tok.(xml.StartElement)
+        if !ok || start.Name.Local != "row" {
+            continue
+        }
+        row := xlsxRow{}
+        if err := dec.DecodeElement(&row, &start); err != nil {
+            return "", err
+        }
+
+        if row.Num == 0 {
+            row.Num = line + 1
+        }
+        for line < row.Num-1 {
+            text.WriteString("\n")
+            line++
+        }
+        text.WriteString(strings.Join(sr.rowCells(row), "\t") + "\n")
+        line++
+    }
+    return text.String(), nil
+}
+
+// rowCells returns the cell texts of a row, placed at their columns
+func (sr *xlsxSheetReader) rowCells(row xlsxRow) []string {
+    cells := []string{}
+    for _, c := range row.Cells {
+        col := len(cells)
+        if c.Ref != "" {
+            if n, ok := xlsxColumn(c.Ref); ok && n >= col {
+                col = n
+            }
+        }
+        for len(cells) < col {
+            cells = append(cells, "")
+        }
+        cells = append(cells, outputText(sr.cellText(c)))
+    }
+    return cells
+}
+
+// cellText returns the text of a cell as a scanner export would hold it
+func (sr *xlsxSheetReader) cellText(c xlsxCell) string {
+    switch c.Type {
+    case "s":
+        i, err := strconv.Atoi(strings.TrimSpace(c.Value))
+        if err != nil || i < 0 || i >= len(sr.strings) {
+            return ""
+        }
+        return sr.strings[i]
+    case "inlineStr":
+        return c.Inline.String()
+    case "b":
+        if strings.TrimSpace(c.Value) == "1" {
+            return "TRUE"
+        }
+        return "FALSE"
+    case "str", "e", "d":
+        // Formula text, an error such as #N/A, or an ISO 8601 date
+        return c.Value
+    }
+    if sr.dates[c.Style] {
+        if v, err := strconv.ParseFloat(strings.TrimSpace(c.Value), 64); err == nil {
+            return xlsxDate(v, sr.date1904)
+        }
+    }
+    return c.Value
+}
+
+// xlsxColumn returns the 0-based column of a cell reference such as "B3"
+func xlsxColumn(ref string) (int, bool) {
+    n := 0
+    i := 0
+    for ; i < len(ref); i++ {
+        c := ref[i]
+        if c >= 'a' && c <= 'z' {
+            c -= 'a' - 'A'
+        }
+        if c < 'A' || c > 'Z' {
+            break
+        }
+        n = n*26 + int(c-'A'+1)
+    }
+    return n - 1, i > 0
+}
+
+// isBuiltinDateFormat reports whether a built-in number format shows a date
+// or time (ECMA-376 Part 1, 18.8.30)
+func isBuiltinDateFormat(id int) bool {
+    return (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+}
+
+// isDateFormat reports whether a custom number format code shows a date or
+// time: it uses a y, m, d, h or s placeholder outside quoted text, escaped
+// characters and [colour] or [$-409] sections
+func isDateFormat(code string) bool {
+    quoted := false
+    bracket := false
+    for i := 0; i < len(code); i++ {
+        c := code[i]
+        switch {
+        case quoted:
+            quoted = c != '"'
+        case bracket:
+            bracket = c != ']'
+        case c == '"':
+            quoted = true
+        case c == '[':
+            bracket = true
+        case c == '\\' || c == '_' || c == '*':
+            i++ // The next character is literal or padding
+        case strings.IndexByte("ymdhsYMDHS", c) >= 0:
+            return true
+        }
+    }
+    return false
+}
+
+// xlsxDate converts a serial date number to an ISO date, with the time of day
+// when the serial has a fraction: 45292 -> 2024-01-01
+// The 1900 system counts from 1899-12-30, which absorbs Excel's phantom
+// 1900-02-29 (serial 60) for every date after February 1900; earlier serials
+// are moved a day on, and the phantom day reads as 1900-02-28
+func xlsxDate(serial float64, date1904 bool) string {
+    base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+    if date1904 {
+        base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+    }
+    days := math.Floor(serial)
+    seconds := math.Round((serial - days) * 86400)
+    if seconds == 86400 {
+        days, seconds = days+1, 0 // Rounded up to midnight
+    }
+    if !date1904 && days < 60 {
+        days++ // Before the phantom 1900-02-29
+    }
+    t := base.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+    if seconds == 0 {
+        return t.Format("2006-01-02")
+    }
+    return t.Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestXlsxDate(t *testing.T) {
+    tests := []struct {
+        serial   float64
+        date1904 bool
+        want     string
+    }{
+        // 1900 system, around Excel's phantom 1900-02-29
+        {1, false, "1900-01-01"},
+        {31, false, "1900-01-31"},
+        {59, false, "1900-02-28"},
+        {60, false, "1900-02-28"}, // Phantom 1900-02-29
+        {61, false, "1900-03-01"},
+        {25569, false, "1970-01-01"},
+        {45292, false, "2024-01-01"},
+        {45351, false, "2024-02-29"},
+
+        // 1904 system
+        {0, true, "1904-01-01"},
+        {59, true, "1904-02-29"},
+        {43830, true, "2024-01-01"},
+
+        // Times of day
+        {45292.5, false, "2024-01-01T12:00:00"},
+        {45292.25, true, "2028-01-02T06:00:00"},
+        {45292.75, false, "2024-01-01T18:00:00"},
+        {45292 + 1.0/86400, false, "2024-01-01T00:00:01"},
+        {45292.0000001, false, "2024-01-01"}, // Rounds down to midnight
+        {45292.9999999, false, "2024-01-02"}, // Rounds up to midnight
+        {59.9999999, false, "1900-02-28"},    // Rounds up to the phantom day
+        {30.5, false, "1900-01-30T12:00:00"},
+    }
+
+    for _, tt := range tests {
+        if got := xlsxDate(tt.serial, tt.date1904); got != tt.want {
+            t.Errorf("xlsxDate(%v, %v) = %q, want %q", tt.serial, tt.date1904, got, tt.want)
+        }
+    }
+}
+
+func TestIsDateFormat(t *testing.T) {
+    tests := []struct {
+        code string
+        want bool
+    }{
+        {"yyyy-mm-dd", true},
+        {"m/d/yy", true},
+        {"DD.MM.YYYY", true},
+        {"h:mm AM/PM", true},
+        {"[h]:mm:ss", true},
+        {"[$-409]mmmm d, yyyy", true},
+        {`yyyy"年"m"月"d"日"`, true},
+        {"General", false},
+        {"0.00", false},
+        {"#,##0.0", false},
+        {"0.00E+00", false},
+        {"@", false},
+        {`0.0" days"`, false}, // Quoted text
+        {`0\d`, false},        // Escaped character
+        {"[Red]0.00", false},  // Colour section
+        {"0_);[Red](0)", false},
+        {"_(* #,##0_)", false}, // Padding
+        {"*s0", false},         // Fill character
+    }
+
+    for _, tt := range tests {
+        if got := isDateFormat(tt.code); got != tt.want {
+            t.Errorf("isDateFormat(%q) = %v, want %v", tt.code, got, tt.want)
+        }
+    }
+}
+
+func TestIsBuiltinDateFormat(t *testing.T) {
+    tests := []struct {
+        id   int
+        want bool
+    }{
+        {0, false},
+        {2, false},
+        {13, false},
+        {14, true},
+        {22, true},
+        {23, false},
+        {45, true},
+        {47, true},
+        {49, false},
+    }
+
+    for _, tt := range tests {
+        if got := isBuiltinDateFormat(tt.id); got != tt.want {
+            t.Errorf("isBuiltinDateFormat(%d) = %v, want %v", tt.id, got, tt.want)
+        }
+    }
+}
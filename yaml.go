@@ -0,0 +1,338 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Spec files may be written in YAML. The standard library has no YAML decoder,
+// so decodeYAML reads the subset a spec needs and returns it as the values
+// encoding/json would decode (map[string]interface{}, []interface{}, string,
+// nil), which are then decoded into a FormatSpec through its JSON tags:
+// - block mappings ("key: value") and block sequences ("- item"), nested by
+//   indentation with spaces
+// - flow sequences ("[a, b]") and flow mappings ("{key: a}") of scalars
+// - plain, 'single-quoted' and "double-quoted" scalars, on one line; plain
+//   scalars are text ("null" and "~" are null), as every spec field is text
+// - comments and the "---" document start
+// Anchors, aliases, tags, block scalars ("|", ">") and multi-line scalars are
+// reported as errors
+
+// yamlLine is a line of YAML without its comment and indentation
+type yamlLine struct {
+    num    int    // 1-based line number
+    indent int    // Number of leading spaces
+    text   string // Content after the indentation
+}
+
+// yamlDecoder reads the lines of one YAML document
+type yamlDecoder struct {
+    lines []yamlLine
+    pos   int
+}
+
+// decodeYAML decodes a YAML document in the subset described above
+func decodeYAML(data []byte) (interface{}, error) {
+    d := &yamlDecoder{}
+    text := strings.TrimPrefix(string(data), "\ufeff")
+    for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+        content := strings.TrimLeft(raw, " ")
+        if strings.HasPrefix(content, "\t") {
+            return nil, fmt.Errorf("line %d: indentation must use spaces", i+1)
+        }
+        content = strings.TrimRight(stripYAMLComment(content), " \t\r")
+        if content == "" {
+            continue
+        }
+        if content == "---" || content == "..." {
+            if len(d.lines) > 0 && content == "---" {
+                return nil, fmt.Errorf("line %d: a spec file holds a single YAML document", i+1)
+            }
+            continue
+        }
+        d.lines = append(d.lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: content})
+    }
+    if len(d.lines) == 0 {
+        return nil, nil
+    }
+
+    v, err := d.node(d.lines[0].indent)
+    if err != nil {
+        return nil, err
+    }
+    if d.pos < len(d.lines) {
+        return nil, fmt.Errorf("line %d: unexpected indentation", d.lines[d.pos].num)
+    }
+    return v, nil
+}
+
+// stripYAMLComment removes a comment: a # at the start of the line or after a
+// space, outside quotes
+func stripYAMLComment(s string) string {
+    quote := byte(0)
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case quote == '\'' && c == '\'':
+            quote = 0
+        case quote == '"' && c == '\\':
+            i++ // Escaped character
+        case quote == '"' && c == '"':
+            quote = 0
+        case quote != 0:
+        case c == '\'' || c == '"':
+            // A quote only opens a scalar at its start
+            if i == 0 || strings.IndexByte(" [{,:-", s[i-1]) >= 0 {
+                quote = c
+            }
+        case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+            return s[:i]
+        }
+    }
+    return s
+}
+
+// isSequenceItem reports whether a line is an item of a block sequence
+func isSequenceItem(text string) bool {
+    return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// node decodes the mapping or sequence whose lines start at indent
+func (d *yamlDecoder) node(indent int) (interface{}, error) {
+    l := d.lines[d.pos]
+    switch {
+    case isSequenceItem(l.text):
+        return d.sequence(indent)
+    case yamlKeyEnd(l.text) >= 0:
+        return d.mapping(indent)
+    }
+    // A lone scalar, e.g. the whole document
+    d.pos++
+    return yamlScalar(l.text, l.num)
+}
+
+// sequence decodes the items of a block sequence at indent
+func (d *yamlDecoder) sequence(indent int) (interface{}, error) {
+    items := []interface{}{}
+    for d.pos < len(d.lines) && d.lines[d.pos].indent == indent && isSequenceItem(d.lines[d.pos].text) {
+        l := d.lines[d.pos]
+        rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+        switch {
+        case rest == "":
+            // The item is on the following, more indented lines
+            d.pos++
+            if d.pos >= len(d.lines) || d.lines[d.pos].indent <= indent {
+                items = append(items, nil)
+                continue
+            }
+            v, err := d.node(d.lines[d.pos].indent)
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, v)
+        case isSequenceItem(rest) || yamlKeyEnd(rest) >= 0:
+            // "- key: value" starts a mapping indented to its first key
+            d.lines[d.pos] = yamlLine{num: l.num, indent: l.indent + len(l.text) - len(rest), text: rest}
+            v, err := d.node(d.lines[d.pos].indent)
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, v)
+        default:
+            v, err := yamlScalar(rest, l.num)
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, v)
+            d.pos++
+        }
+    }
+    if d.pos < len(d.lines) && d.lines[d.pos].indent > indent {
+        return nil, fmt.Errorf("line %d: unexpected indentation", d.lines[d.pos].num)
+    }
+    return items, nil
+}
+
+// mapping decodes the keys of a block mapping at indent
+func (d *yamlDecoder) mapping(indent int) (interface{}, error) {
+    m := map[string]interface{}{}
+    for d.pos < len(d.lines) && d.lines[d.pos].indent == indent && !isSequenceItem(d.lines[d.pos].text) {
+        l := d.lines[d.pos]
+        end := yamlKeyEnd(l.text)
+        if end < 0 {
+            return nil, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+        }
+        k, err := yamlScalar(strings.TrimSpace(l.text[:end]), l.num)
+        if err != nil {
+            return nil, err
+        }
+        key, ok := k.(string)
+        if !ok {
+            return nil, fmt.Errorf("line %d: missing key", l.num)
+        }
+        if _, dup := m[key]; dup {
+            return nil, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+        }
+        rest := strings.TrimSpace(l.text[end+1:])
+        d.pos++
+
+        switch {
+        case rest != "":
+            m[key], err = yamlScalar(rest, l.num)
+        case d.pos < len(d.lines) && d.lines[d.pos].indent > indent:
+            m[key], err = d.node(d.lines[d.pos].indent)
+        case d.pos < len(d.lines) && d.lines[d.pos].indent == indent && isSequenceItem(d.lines[d.pos].text):
+            // A sequence may sit at the indentation of its key
+            m[key], err = d.sequence(indent)
+        default:
+            m[key] = nil
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    if d.pos < len(d.lines) && d.lines[d.pos].indent > indent {
+        return nil, fmt.Errorf("line %d: unexpected indentation", d.lines[d.pos].num)
+    }
+    return m, nil
+}
+
+// yamlKeyEnd returns the position of the colon that ends the key of a
+// "key: value" line, or -1. The colon is outside quotes and is followed by a
+// space or the end of the line
+func yamlKeyEnd(s string) int {
+    if s == "" || s[0] == '[' || s[0] == '{' {
+        return -1
+    }
+    quote, start := byte(0), 0
+    if s[0] == '\'' || s[0] == '"' {
+        quote, start = s[0], 1
+    }
+    for i := start; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote == 0 && c == ':' && (i+1 == len(s) || s[i+1] == ' '):
+            return i
+        }
+    }
+    return -1
+}
+
+// yamlScalar decodes a value written on one line: a quoted or plain scalar, or
+// a flow sequence or mapping of scalars
+func yamlScalar(s string, num int) (interface{}, error) {
+    if s == "" {
+        return nil, nil
+    }
+    switch s[0] {
+    case '[':
+        if !strings.HasSuffix(s, "]") {
+            return nil, fmt.Errorf("line %d: flow sequences must end on their line", num)
+        }
+        items := []interface{}{}
+        for _, part := range splitYAMLFlow(s[1 : len(s)-1]) {
+            if part != "" && (part[0] == '[' || part[0] == '{') {
+                return nil, fmt.Errorf("line %d: nested flow collections are not supported", num)
+            }
+            v, err := yamlScalar(part, num)
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, v)
+        }
+        return items, nil
+    case '{':
+        if !strings.HasSuffix(s, "}") {
+            return nil, fmt.Errorf("line %d: flow mappings must end on their line", num)
+        }
+        m := map[string]interface{}{}
+        for _, part := range splitYAMLFlow(s[1 : len(s)-1]) {
+            end := yamlKeyEnd(part)
+            if end < 0 {
+                return nil, fmt.Errorf("line %d: expected \"key: value\" in %q", num, part)
+            }
+            k, err := yamlScalar(strings.TrimSpace(part[:end]), num)
+            if err != nil {
+                return nil, err
+            }
+            key, ok := k.(string)
+            if !ok {
+                return nil, fmt.Errorf("line %d: missing key in %q", num, part)
+            }
+            if _, dup := m[key]; dup {
+                return nil, fmt.Errorf("line %d: duplicate key %q", num, key)
+            }
+            v := strings.TrimSpace(part[end+1:])
+            if v != "" && (v[0] == '[' || v[0] == '{') {
+                return nil, fmt.Errorf("line %d: nested flow collections are not supported", num)
+            }
+            if m[key], err = yamlScalar(v, num); err != nil {
+                return nil, err
+            }
+        }
+        return m, nil
+    case '"':
+        v, err := strconv.Unquote(s)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid double-quoted scalar %s", num, s)
+        }
+        return v, nil
+    case '\'':
+        if len(s) < 2 || !strings.HasSuffix(s, "'") {
+            return nil, fmt.Errorf("line %d: single-quoted scalars must end on their line", num)
+        }
+        inner := s[1 : len(s)-1]
+        if strings.Contains(strings.ReplaceAll(inner, "''", ""), "'") {
+            return nil, fmt.Errorf("line %d: invalid single-quoted scalar %s", num, s)
+        }
+        return strings.ReplaceAll(inner, "''", "'"), nil
+    case '|', '>':
+        return nil, fmt.Errorf("line %d: YAML block scalars are not supported; write the value on one line", num)
+    case '&', '*':
+        return nil, fmt.Errorf("line %d: YAML anchors and aliases are not supported", num)
+    case '!':
+        return nil, fmt.Errorf("line %d: YAML tags are not supported", num)
+    case '?', '%', '@', '`':
+        return nil, fmt.Errorf("line %d: a plain scalar can't start with %q; quote it", num, s[0])
+    }
+    if s == "null" || s == "Null" || s == "NULL" || s == "~" {
+        return nil, nil
+    }
+    return s, nil
+}
+
+// splitYAMLFlow splits the inside of a flow collection at the commas outside
+// quotes and brackets; a trailing comma adds no part
+func splitYAMLFlow(s string) []string {
+    parts := []string{}
+    quote := byte(0)
+    depth, start := 0, 0
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote != 0:
+        case (c == '"' || c == '\'') && strings.TrimSpace(s[start:i]) == "":
+            quote = c
+        case c == '[' || c == '{':
+            depth++
+        case c == ']' || c == '}':
+            depth--
+        case c == ',' && depth == 0:
+            parts = append(parts, strings.TrimSpace(s[start:i]))
+            start = i + 1
+        }
+    }
+    if last := strings.TrimSpace(s[start:]); last != "" {
+        parts = append(parts, last)
+    }
+    return parts
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+        want  string // JSON encoding of the decoded document
+    }{
+        {"empty", "# Only a comment\n", `null`},
+        {"mapping", "name: heel\ntitle: Heel Ultrasound (QUS)\n", `{"name":"heel","title":"Heel Ultrasound (QUS)"}`},
+        {"document start and CRLF", "---\r\nname: heel\r\n", `{"name":"heel"}`},
+        {"comments", "# Spec\nname: heel # Short name\nkey: 'a # b'\n", `{"key":"a # b","name":"heel"}`},
+        {"null values", "a:\nb: ~\nc: null\n", `{"a":null,"b":null,"c":null}`},
+        {"plain text stays text", "a: 12\nb: true\n", `{"a":"12","b":"true"}`},
+        {"quoted scalars", `a: "\\bbua\\b"` + "\nb: '\\bbua\\b'\nc: 'it''s'\n", `{"a":"\\bbua\\b","b":"\\bbua\\b","c":"it's"}`},
+        {"colons in values", "match: ^a:b\nurl: \"x: y\"\n", `{"match":"^a:b","url":"x: y"}`},
+        {"quoted key", "\"a: b\": c\n", `{"a: b":"c"}`},
+        {"flow sequence", "detect: ['\\bbua\\b', stiffness, \"a, b\",]\n", `{"detect":["\\bbua\\b","stiffness","a, b"]}`},
+        {"empty flow sequence", "detect: []\n", `{"detect":[]}`},
+        {"flow mapping", "- {match: ^right bua, side: right, unit: 'dB/MHz'}\n", `[{"match":"^right bua","side":"right","unit":"dB/MHz"}]`},
+        {"indented sequence", "detect:\n  - bua\n  - stiffness\n", `{"detect":["bua","stiffness"]}`},
+        {"sequence at key indentation", "detect:\n- bua\n- stiffness\nname: heel\n", `{"detect":["bua","stiffness"],"name":"heel"}`},
+        {
+            "sequence of mappings",
+            "columns:\n  - match: ^left bua\n    side: left\n\n  - match: sos\n    key: Speed_Of_Sound\nname: heel\n",
+            `{"columns":[{"match":"^left bua","side":"left"},{"key":"Speed_Of_Sound","match":"sos"}],"name":"heel"}`,
+        },
+        {"item on the next line", "-\n  a: b\n- c\n", `[{"a":"b"},"c"]`},
+        {"nested sequences", "- - a\n  - b\n- c\n", `[["a","b"],"c"]`},
+        {"nested mappings", "a:\n  b:\n    c: d\n  e: f\ng: h\n", `{"a":{"b":{"c":"d"},"e":"f"},"g":"h"}`},
+        {"byte order mark", "\ufeffname: heel\n", `{"name":"heel"}`},
+    }
+
+    for _, tt := range tests {
+        v, err := decodeYAML([]byte(tt.input))
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        got, _ := json.Marshal(v)
+        if string(got) != tt.want {
+            t.Errorf("%s: decodeYAML(%q) = %s, want %s", tt.name, tt.input, got, tt.want)
+        }
+    }
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        want  string
+    }{
+        {"name: heel\n\ttitle: x\n", "line 2: indentation must use spaces"},
+        {"name: heel\n  title: x\n", "line 2: unexpected indentation"},
+        {"name: heel\nname: foot\n", `line 2: duplicate key "name"`},
+        {"name: heel\njust text\n", `line 2: expected "key: value"`},
+        {"title: |\n  Heel\n", "line 1: YAML block scalars are not supported"},
+        {"base: &b x\n", "line 1: YAML anchors and aliases are not supported"},
+        {"name: !!str heel\n", "line 1: YAML tags are not supported"},
+        {"detect: [a, [b]]\n", "line 1: nested flow collections are not supported"},
+        {"detect: [a,\n  b]\n", "line 1: flow sequences must end on their line"},
+        {"name: 'heel\n", "line 1: single-quoted scalars must end on their line"},
+        {"name: \"he\\qel\"\n", "line 1: invalid double-quoted scalar"},
+        {"a: b\n---\nc: d\n", "line 2: a spec file holds a single YAML document"},
+    }
+
+    for _, tt := range tests {
+        _, err := decodeYAML([]byte(tt.input))
+        if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+            t.Errorf("decodeYAML(%q) error = %v, want %q", tt.input, err, tt.want)
+        }
+    }
+}
+
+func TestReadSpecYAML(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "heel.json": `{
+  "name": "heel",
+  "title": "Heel Ultrasound (QUS)",
+  "detect": ["\\bbua\\b", "stiffness"],
+  "columns": [
+    {"match": "^left bua", "region": "Heel", "side": "left", "metric": "BUA", "unit": "dB/MHz"},
+    {"match": "stiffness", "key": "Stiffness_Index", "metric": "Stiffness Index"}
+  ]
+}`,
+        "heel.yaml": `# Heel ultrasound
+name: heel
+title: Heel Ultrasound (QUS)
+detect: ['\bbua\b', stiffness]
+columns:
+  - match: ^left bua
+    region: Heel
+    side: left
+    metric: BUA
+    unit: dB/MHz
+  - {match: stiffness, key: Stiffness_Index, metric: Stiffness Index}
+`,
+        "list.yml": "- name: heel\n",
+    }
+    for name, text := range files {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    want, err := readSpec(filepath.Join(dir, "heel.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := readSpec(filepath.Join(dir, "heel.yaml"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    got.file, want.file = "", ""
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("YAML spec = %+v, want %+v", got, want)
+    }
+
+    if _, err := readSpec(filepath.Join(dir, "list.yml")); err == nil || err.Error() != "expected a mapping of spec fields" {
+        t.Errorf("readSpec(list.yml) error = %v, want a mapping error", err)
+    }
+}